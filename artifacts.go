@@ -0,0 +1,51 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"strings"
+)
+
+//Contracts are compiled ahead of time by solcgen into build/, which is
+//committed, and the bytecode and ABI embedded in the binary. Run go generate
+//after changing a .sol file and commit the result; the build fails if the
+//artifacts are missing, and go test (see artifacts_test.go) if they're stale.
+//go:generate go run ./solcgen
+
+//go:embed ethduck.sol factory.sol spectators.sol
+var solSources embed.FS
+
+//go:embed build/*.bin build/*.abi build/sources.sha256
+var artifacts embed.FS
+
+//ABIs of older EthDuck versions, for games published before
+//ethduck.sol changed, see versions.go
+//
+//go:embed legacy/*.abi
+var legacyABIs embed.FS
+
+//go:embed templates
+var templateFiles embed.FS
+
+//Artifact is a compiled contract, ready to publish with bcyeth.Contract's Bin and ABI
+type Artifact struct {
+	Bin string
+	ABI json.RawMessage
+}
+
+//compiled contracts by name
+var contracts = make(map[string]Artifact)
+
+func init() {
+	for _, name := range []string{"EthDuck", "EthDuckFactory", "SpectatorMarket"} {
+		bin, err := artifacts.ReadFile("build/" + name + ".bin")
+		if err != nil {
+			panic(err)
+		}
+		abi, err := artifacts.ReadFile("build/" + name + ".abi")
+		if err != nil {
+			panic(err)
+		}
+		contracts[name] = Artifact{strings.TrimSpace(string(bin)), json.RawMessage(abi)}
+	}
+}
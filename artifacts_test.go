@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+//TestArtifactsFresh checks the embedded sources still hash to what
+//the embedded artifacts in build/ were compiled from
+func TestArtifactsFresh(t *testing.T) {
+	sums, err := artifacts.ReadFile("build/sources.sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			t.Fatal("build/sources.sha256 is malformed, run go generate")
+		}
+		src, err := solSources.ReadFile(fields[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(src)
+		if hex.EncodeToString(sum[:]) != fields[0] {
+			t.Errorf("%s changed since its contracts were compiled, run go generate", fields[1])
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArtifactsLoaded(t *testing.T) {
+	for _, name := range []string{"EthDuck", "EthDuckFactory", "SpectatorMarket"} {
+		c, ok := contracts[name]
+		if !ok || c.Bin == "" || len(c.ABI) == 0 {
+			t.Errorf("%s has no compiled artifact in build/, run go generate", name)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package bcyeth
 
-import "math/big"
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Addr struct {
 	Address            string  `json:"address"`
@@ -12,13 +19,215 @@ type Addr struct {
 	NTx                int     `json:"n_tx"`
 	UnconfirmedNTx     int     `json:"unconfirmed_n_tx"`
 	FinalNTx           int     `json:"final_n_tx"`
+	//from GetAddr
+	TXRefs            []TXRef `json:"txrefs,omitempty"`
+	UnconfirmedTXRefs []TXRef `json:"unconfirmed_txrefs,omitempty"`
+	//from GetAddrFull
+	TXs []TX `json:"txs,omitempty"`
+	//HasMore is true if there are older transactions than
+	//this page of TXRefs or TXs, see NextPage
+	HasMore bool `json:"hasMore,omitempty"`
+	//transactions the page's "seen" param dropped, and their block
+	seen       []string
+	seenHeight int
+}
+
+//TXRef is a summary of a transaction an address was part of
+type TXRef struct {
+	Address       string    `json:"address,omitempty"`
+	BlockHeight   int       `json:"block_height"`
+	TXHash        string    `json:"tx_hash"`
+	TXInputN      int       `json:"tx_input_n"`
+	TXOutputN     int       `json:"tx_output_n"`
+	Value         big.Int   `json:"value"`
+	Confirmations int       `json:"confirmations"`
+	Confirmed     time.Time `json:"confirmed,omitempty"`
+	DoubleSpend   bool      `json:"double_spend"`
 }
 
 func (api *API) GetAddrBal(addr string) (address Addr, err error) {
+	return api.GetAddrBalContext(context.Background(), addr)
+}
+
+//GetAddrBalContext is GetAddrBal, but gives up when ctx is done
+func (api *API) GetAddrBalContext(ctx context.Context, addr string) (address Addr, err error) {
 	u, err := api.buildURL("/addrs/"+addr+"/balance", nil)
 	if err != nil {
 		return
 	}
-	err = getResponse(u, &address)
+	err = api.getResponse(ctx, u, &address)
+	return
+}
+
+//GetAddr returns an address's balance and TXRefs, newest first.
+//Optional params are "before" and "after" (block heights),
+//"limit" (TXRefs per page, 50 unless set, at most 2000) and
+//"confirmations" (only TXRefs with at least that many), and
+//"seen", which NextPage sets to the comma separated hashes to
+//leave out since the last page had them
+func (api *API) GetAddr(addr string, params map[string]string) (address Addr, err error) {
+	return api.GetAddrContext(context.Background(), addr, params)
+}
+
+//GetAddrContext is GetAddr, but gives up when ctx is done
+func (api *API) GetAddrContext(ctx context.Context, addr string, params map[string]string) (address Addr, err error) {
+	return api.getAddrPage(ctx, "/addrs/"+addr, params)
+}
+
+//GetAddrFull returns an address's balance and full TXs, newest first.
+//It takes the same params as GetAddr, except "limit" is 10 unless
+//set and at most 50
+func (api *API) GetAddrFull(addr string, params map[string]string) (address Addr, err error) {
+	return api.GetAddrFullContext(context.Background(), addr, params)
+}
+
+//GetAddrFullContext is GetAddrFull, but gives up when ctx is done
+func (api *API) GetAddrFullContext(ctx context.Context, addr string, params map[string]string) (address Addr, err error) {
+	return api.getAddrPage(ctx, "/addrs/"+addr+"/full", params)
+}
+
+//getAddrPage gets a page of an address's transactions, leaving out the
+//ones in params' "seen", and asking for that many more to make up for them
+func (api *API) getAddrPage(ctx context.Context, path string, params map[string]string) (address Addr, err error) {
+	var seen []string
+	if params["seen"] != "" {
+		seen = strings.Split(params["seen"], ",")
+	}
+	query := make(map[string]string)
+	for k, v := range params {
+		query[k] = v
+	}
+	delete(query, "seen")
+	if limit, convErr := strconv.Atoi(query["limit"]); convErr == nil && len(seen) > 0 {
+		query["limit"] = strconv.Itoa(limit + len(seen))
+	}
+	u, err := api.buildURL(path, query)
+	if err != nil {
+		return
+	}
+	if err = api.getResponse(ctx, u, &address); err != nil {
+		return
+	}
+	if len(seen) == 0 {
+		return
+	}
+	drop := make(map[string]bool)
+	for _, hash := range seen {
+		drop[hash] = true
+	}
+	refs, txs := address.TXRefs[:0], address.TXs[:0]
+	for _, ref := range address.TXRefs {
+		if !drop[ref.TXHash] {
+			refs = append(refs, ref)
+		}
+	}
+	for _, tx := range address.TXs {
+		if !drop[tx.Hash] {
+			txs = append(txs, tx)
+		}
+	}
+	address.TXRefs, address.TXs = refs, txs
+	address.seen = seen
+	address.seenHeight, _ = strconv.Atoi(params["before"])
+	address.seenHeight--
+	return
+}
+
+//AddrKeychain is a new address and its keys, from GenAddrKeychain
+type AddrKeychain struct {
+	Address string `json:"address"`
+	Private string `json:"private"`
+	Public  string `json:"public"`
+}
+
+//GenAddrKeychain has BlockCypher generate a new address and keypair;
+//the private key travels over the network, so only use it for testing
+//or small amounts
+func (api *API) GenAddrKeychain() (pair AddrKeychain, err error) {
+	return api.GenAddrKeychainContext(context.Background())
+}
+
+//GenAddrKeychainContext is GenAddrKeychain, but gives up when ctx is done
+func (api *API) GenAddrKeychainContext(ctx context.Context) (pair AddrKeychain, err error) {
+	u, err := api.buildURL("/addrs", nil)
+	if err != nil {
+		return
+	}
+	err = api.postResponse(ctx, u, nil, &pair)
+	return
+}
+
+//Faucet sends amount wei of BlockCypher's testnet ether to addr, returning
+//the transaction hash; it only works on the testnet, see NewTest
+func (api *API) Faucet(addr string, amount big.Int) (txHash string, err error) {
+	return api.FaucetContext(context.Background(), addr, amount)
+}
+
+//FaucetContext is Faucet, but gives up when ctx is done
+func (api *API) FaucetContext(ctx context.Context, addr string, amount big.Int) (txHash string, err error) {
+	if api.Coin != "beth" {
+		err = errors.New("bcyeth: the faucet is only on BlockCypher's testnet, beth/test")
+		return
+	}
+	u, err := api.buildURL("/faucet", nil)
+	if err != nil {
+		return
+	}
+	req := struct {
+		Address string  `json:"address"`
+		Amount  big.Int `json:"amount"`
+	}{addr, amount}
+	var resp struct {
+		TXRef string `json:"tx_ref"`
+	}
+	err = api.postResponse(ctx, u, &req, &resp)
+	txHash = resp.TXRef
+	return
+}
+
+//NextPage returns params for the page of transactions older than
+//this one from GetAddr or GetAddrFull, with the given limit (0
+//for the default), or nil if there are no more. A block's
+//transactions can be split across pages, so the next page starts
+//at this one's oldest block, with the transactions from that block
+//already seen in "seen"
+func (a Addr) NextPage(limit int) (params map[string]string) {
+	if !a.HasMore {
+		return
+	}
+	//unconfirmed transactions have no block, -1
+	oldest := -1
+	for _, ref := range a.TXRefs {
+		if ref.BlockHeight > 0 && (oldest < 0 || ref.BlockHeight < oldest) {
+			oldest = ref.BlockHeight
+		}
+	}
+	for _, tx := range a.TXs {
+		if tx.BlockHeight > 0 && (oldest < 0 || tx.BlockHeight < oldest) {
+			oldest = tx.BlockHeight
+		}
+	}
+	if oldest < 0 {
+		return
+	}
+	var seen []string
+	//the whole page was in the block the last one ended in
+	if oldest == a.seenHeight {
+		seen = append(seen, a.seen...)
+	}
+	for _, ref := range a.TXRefs {
+		if ref.BlockHeight == oldest {
+			seen = append(seen, ref.TXHash)
+		}
+	}
+	for _, tx := range a.TXs {
+		if tx.BlockHeight == oldest {
+			seen = append(seen, tx.Hash)
+		}
+	}
+	params = map[string]string{"before": strconv.Itoa(oldest + 1), "seen": strings.Join(seen, ",")}
+	if limit > 0 {
+		params["limit"] = strconv.Itoa(limit)
+	}
 	return
 }
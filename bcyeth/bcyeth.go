@@ -4,38 +4,72 @@ package bcyeth
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
 	"net/url"
 	"strconv"
-
-	"../bcytoken"
+	"strings"
+	"time"
 )
 
-const baseURL = bcytoken.BaseURL
+//DefaultBaseURL is BlockCypher's API, without the coin/chain
+const DefaultBaseURL = "https://api.blockcypher.com/v1"
+
+//DefaultSocketURL is BlockCypher's WebSocket event stream, without the coin/chain
+const DefaultSocketURL = "wss://socket.blockcypher.com/v1"
 
 //API stores your BlockCypher Token, and the coin/chain
-//you're querying. Only combo available is "eth"/"main" for now.
+//you're querying: "eth"/"main" for Ethereum, or "beth"/"test"
+//for BlockCypher's Ethereum testnet. Empty fields default to
+//Ethereum's main network on DefaultBaseURL.
 //Check http://dev.blockcypher.com/eth for more information.
 //All your credentials are stored within an API struct, as are
 //many of the API methods.
 //You can allocate an API struct like so:
-//	bc = gobcy.API{"your-api-token"}
+//
+//	bc = bcyeth.NewMain("your-api-token")
 type API struct {
 	Token string
+	Coin  string
+	Chain string
+	//BaseURL overrides BlockCypher's, to point at a mirror
+	//or a fake like bcyethtest's
+	BaseURL string
+	//SocketURL overrides BlockCypher's event stream, see NewStream
+	SocketURL string
+	//Client makes the API's requests, http.DefaultClient if nil;
+	//set one with a Timeout, or a custom Transport
+	Client *http.Client
+	//Retry retries failed requests that are safe to repeat, see
+	//RetryPolicy; nil never retries
+	Retry *RetryPolicy
+	//Limiters hold back requests to stay under the token's
+	//limits, see Limiter; share them between APIs using one token
+	Limiters []*Limiter
+}
+
+//NewMain returns an API for Ethereum's main network
+func NewMain(token string) API {
+	return API{Token: token, Coin: "eth", Chain: "main", BaseURL: DefaultBaseURL, SocketURL: DefaultSocketURL}
+}
+
+//NewTest returns an API for BlockCypher's Ethereum testnet,
+//whose ether comes from its faucet
+func NewTest(token string) API {
+	return API{Token: token, Coin: "beth", Chain: "test", BaseURL: DefaultBaseURL, SocketURL: DefaultSocketURL}
 }
 
 //getResponse is a boilerplate for HTTP GET responses.
-func getResponse(target *url.URL, decTarget interface{}) (err error) {
-	resp, err := http.Get(target.String())
+func (api *API) getResponse(ctx context.Context, target *url.URL, decTarget interface{}) (err error) {
+	resp, err := api.do(ctx, "GET", target, nil)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		err = respErrorMaker(resp.StatusCode, resp.Body)
+		err = respErrorMaker(resp)
 		return
 	}
 	dec := json.NewDecoder(resp.Body)
@@ -45,19 +79,19 @@ func getResponse(target *url.URL, decTarget interface{}) (err error) {
 }
 
 //postResponse is a boilerplate for HTTP POST responses.
-func postResponse(target *url.URL, encTarget interface{}, decTarget interface{}) (err error) {
+func (api *API) postResponse(ctx context.Context, target *url.URL, encTarget interface{}, decTarget interface{}) (err error) {
 	var data bytes.Buffer
 	enc := json.NewEncoder(&data)
 	if err = enc.Encode(encTarget); err != nil {
 		return
 	}
-	resp, err := http.Post(target.String(), "application/json", &data)
+	resp, err := api.do(ctx, "POST", target, data.Bytes())
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		err = respErrorMaker(resp.StatusCode, resp.Body)
+		err = respErrorMaker(resp)
 		return
 	}
 	dec := json.NewDecoder(resp.Body)
@@ -67,51 +101,94 @@ func postResponse(target *url.URL, encTarget interface{}, decTarget interface{})
 }
 
 //putResponse is a boilerplate for HTTP PUT responses.
-func putResponse(target *url.URL, encTarget interface{}) (err error) {
+func (api *API) putResponse(ctx context.Context, target *url.URL, encTarget interface{}) (err error) {
 	var data bytes.Buffer
 	enc := json.NewEncoder(&data)
 	if err = enc.Encode(encTarget); err != nil {
 		return
 	}
-	req, err := http.NewRequest("PUT", target.String(), &data)
-	if err != nil {
-		return
-	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := api.do(ctx, "PUT", target, data.Bytes())
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		err = respErrorMaker(resp.StatusCode, resp.Body)
+		err = respErrorMaker(resp)
 	}
 	return
 }
 
 //deleteResponse is a boilerplate for HTTP DELETE responses.
-func deleteResponse(target *url.URL) (err error) {
-	req, err := http.NewRequest("DELETE", target.String(), nil)
-	if err != nil {
-		return
-	}
-	resp, err := http.DefaultClient.Do(req)
+func (api *API) deleteResponse(ctx context.Context, target *url.URL) (err error) {
+	resp, err := api.do(ctx, "DELETE", target, nil)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		err = respErrorMaker(resp.StatusCode, resp.Body)
+		err = respErrorMaker(resp)
 	}
 	return
 }
 
+//client is the API's http.Client, or http.DefaultClient if it has none
+func (api *API) client() *http.Client {
+	if api.Client != nil {
+		return api.Client
+	}
+	return http.DefaultClient
+}
+
+//APIError is an error response from BlockCypher
+type APIError struct {
+	StatusCode int
+	//Errors are BlockCypher's messages, if it sent any
+	Errors []string
+	//RetryAfter is how long BlockCypher asked to wait
+	//before trying again, 0 if it didn't say
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	status := "HTTP " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+	if len(e.Errors) == 0 {
+		return status
+	}
+	return status + ", Message(s): " + strings.Join(e.Errors, ", ")
+}
+
+//IsRateLimited reports whether err is BlockCypher
+//turning a request away for going over the token's limits
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+//IsNotFound reports whether err is BlockCypher not finding
+//what was asked for, like an address or contract
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+//IsThrow reports whether err is BlockCypher rejecting a request outright,
+//like a contract call that throws or a method the ABI doesn't have; unlike
+//rate limits, timeouts and server errors, trying again won't help
+func IsThrow(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest
+}
+
 //respErrorMaker checks error messages/if they are multiple errors
-//serializes them into a single error message
-func respErrorMaker(statusCode int, body io.Reader) (err error) {
-	status := "HTTP " + strconv.Itoa(statusCode) + " " + http.StatusText(statusCode)
-	if statusCode == 429 {
-		err = errors.New(status)
-		return
+//collects them into an APIError
+func respErrorMaker(resp *http.Response) (err error) {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if retry := resp.Header.Get("Retry-After"); retry != "" {
+		if secs, convErr := strconv.Atoi(retry); convErr == nil {
+			apiErr.RetryAfter = time.Duration(secs) * time.Second
+		} else if when, convErr := http.ParseTime(retry); convErr == nil {
+			apiErr.RetryAfter = time.Until(when)
+		}
 	}
 	type errorJSON struct {
 		Err    string `json:"error"`
@@ -120,31 +197,33 @@ func respErrorMaker(statusCode int, body io.Reader) (err error) {
 		} `json:"errors"`
 	}
 	var msg errorJSON
-	dec := json.NewDecoder(body)
-	err = dec.Decode(&msg)
-	if err != nil {
-		return err
-	}
-	var errtxt string
-	errtxt += msg.Err
-	for i, v := range msg.Errors {
-		if i == len(msg.Errors)-1 {
-			errtxt += v.Err
-		} else {
-			errtxt += v.Err + ", "
+	//rate limited responses (and some others) have no JSON body,
+	//then the status is all there is to go on
+	if json.NewDecoder(resp.Body).Decode(&msg) == nil {
+		if msg.Err != "" {
+			apiErr.Errors = append(apiErr.Errors, msg.Err)
+		}
+		for _, v := range msg.Errors {
+			apiErr.Errors = append(apiErr.Errors, v.Err)
 		}
 	}
-	if errtxt == "" {
-		err = errors.New(status)
-	} else {
-		err = errors.New(status + ", Message(s): " + errtxt)
-	}
+	err = apiErr
 	return
 }
 
 //constructs BlockCypher URLs with parameters for requests
 func (api *API) buildURL(u string, params map[string]string) (target *url.URL, err error) {
-	target, err = url.Parse(baseURL + u)
+	base, coin, chain := api.BaseURL, api.Coin, api.Chain
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	if coin == "" {
+		coin = "eth"
+	}
+	if chain == "" {
+		chain = "main"
+	}
+	target, err = url.Parse(base + "/" + coin + "/" + chain + u)
 	if err != nil {
 		return
 	}
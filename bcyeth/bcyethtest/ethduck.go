@@ -0,0 +1,419 @@
+package bcyethtest
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+//version of ethduck.sol the fake plays along with
+const ethDuckVersion = 2
+
+const zeroAddr = "0000000000000000000000000000000000000000"
+
+//colors, like ethduck.sol's State
+const (
+	empty = iota
+	black
+	white
+)
+
+//errThrow is what a throw in the contract comes back as
+var errThrow = errors.New("Error: the contract throws")
+
+type move struct {
+	x, y, color int
+}
+
+//game is EthDuck's state; nigiri and state channels aren't
+//supported, their getters are always unset
+type game struct {
+	size          int
+	black         string
+	white         string
+	confirmed     bool
+	blackTurn     bool
+	approvalLock  bool
+	draw          bool
+	winner        int
+	winnerShare   int
+	sideBets      bool
+	moves         []move
+	stakes        []*big.Int
+	proposed      move
+	proposedStake *big.Int
+	sideBetPot    *big.Int
+	balance       *big.Int
+	//spectator market, told the result when the game settles or is refunded
+	market string
+	//set once the game settles or is refunded, and self-destructs,
+	//with the result it tells the market
+	destroyed bool
+	result    int
+}
+
+//newGame runs EthDuck's constructor:
+//(uint8 boardSize, address player2, uint8 winnerShare, bool sideBets, bytes32 commit)
+func newGame(sender string, params []interface{}, value *big.Int) (g *game, err error) {
+	if len(params) != 5 {
+		err = errors.New("EthDuck takes 5 constructor params")
+		return
+	}
+	g = &game{
+		black:         sender,
+		market:        zeroAddr,
+		proposedStake: new(big.Int),
+		sideBetPot:    new(big.Int),
+		balance:       new(big.Int).Set(value),
+	}
+	if g.size, err = intParam(params, 0); err != nil {
+		return
+	}
+	if g.white, err = addrParam(params, 1); err != nil {
+		return
+	}
+	if g.winnerShare, err = intParam(params, 2); err != nil {
+		return
+	}
+	if g.sideBets, err = boolParam(params, 3); err != nil {
+		return
+	}
+	commit, err := stringParam(params, 4)
+	if err != nil {
+		return
+	}
+	if strings.Trim(commit, "0x") != "" {
+		err = errors.New("bcyethtest doesn't support nigiri")
+		return
+	}
+	if g.winnerShare < 50 || g.winnerShare > 100 {
+		err = errThrow
+	}
+	return
+}
+
+//call runs a method as sender, with value sent along; payouts are
+//what the contract sends out, by address
+func (g *game) call(sender string, method string, params []interface{}, value *big.Int) (results []interface{}, payouts map[string]*big.Int, err error) {
+	if getter, ok := g.getters()[method]; ok {
+		results, err = getter(params)
+		return
+	}
+	payable := method == "confirmNewGame" || method == "proposeMove" ||
+		method == "authorizeMove" || method == "authorizeAndPropose"
+	if !payable && value.Sign() != 0 {
+		err = errThrow
+		return
+	}
+	//methods check everything before changing state, so a throw reverts nothing
+	switch method {
+	case "confirmNewGame":
+		err = g.confirmNewGame(sender, value)
+	case "refundGame":
+		if sender == g.black && !g.confirmed {
+			payouts = map[string]*big.Int{g.black: g.balance}
+			g.destroyed, g.result = true, 3
+		}
+	case "setMarket":
+		var market string
+		if market, err = addrParam(params, 0); err != nil {
+			return
+		}
+		if (sender != g.black && sender != g.white) || g.market != zeroAddr || !g.confirmed {
+			err = errThrow
+			return
+		}
+		g.market = market
+	case "proposeMove":
+		var x, y int
+		if x, y, err = g.point(params); err != nil {
+			return
+		}
+		if err = g.onlyPropose(sender); err != nil {
+			return
+		}
+		err = g.makeMove(sender, x, y, value)
+	case "authorizeMove":
+		var approve bool
+		if approve, err = boolParam(params, 0); err != nil {
+			return
+		}
+		if err = g.onlyAuthorize(sender); err != nil {
+			return
+		}
+		match := new(big.Int)
+		if approve {
+			match = g.proposedStake
+		}
+		if value.Cmp(match) != 0 {
+			err = errThrow
+			return
+		}
+		payouts = g.approveMove(sender, approve, value)
+	case "authorizeAndPropose":
+		var x, y int
+		if x, y, err = g.point(params); err != nil {
+			return
+		}
+		if err = g.onlyAuthorize(sender); err != nil {
+			return
+		}
+		stake := new(big.Int).Sub(value, g.proposedStake)
+		if g.draw || g.winner != empty || stake.Sign() < 0 || (!g.sideBets && stake.Sign() > 0) {
+			err = errThrow
+			return
+		}
+		g.approveMove(sender, true, g.proposedStake)
+		err = g.makeMove(sender, x, y, stake)
+	case "proposeWinner", "proposeDraw":
+		if err = g.onlyPropose(sender); err != nil {
+			return
+		}
+		if method == "proposeDraw" {
+			g.draw = true
+		} else {
+			g.winner = g.color(sender)
+		}
+		g.approvalLock = true
+	case "authorizeWinner", "authorizeDraw":
+		var approve bool
+		if approve, err = boolParam(params, 0); err != nil {
+			return
+		}
+		if err = g.onlyAuthorize(sender); err != nil {
+			return
+		}
+		if method == "authorizeDraw" && g.draw {
+			if approve {
+				payouts = g.settle(3)
+			} else {
+				g.draw, g.approvalLock = false, false
+			}
+		} else if method == "authorizeWinner" && g.winner != empty {
+			if approve {
+				payouts = g.settle(g.winner)
+			} else {
+				g.winner, g.approvalLock = empty, false
+			}
+		}
+	default:
+		err = errors.New("EthDuck has no method " + method)
+	}
+	return
+}
+
+//constant reports whether a method only reads the game, and isn't a transaction
+func (g *game) constant(method string) bool {
+	_, ok := g.getters()[method]
+	return ok
+}
+
+//getters are EthDuck's constant methods and public variables
+func (g *game) getters() map[string]func([]interface{}) ([]interface{}, error) {
+	unset := func([]interface{}) ([]interface{}, error) { return []interface{}{false}, nil }
+	value := func(v interface{}) func([]interface{}) ([]interface{}, error) {
+		return func([]interface{}) ([]interface{}, error) { return []interface{}{v}, nil }
+	}
+	return map[string]func([]interface{}) ([]interface{}, error){
+		"version":         value(ethDuckVersion),
+		"size":            value(g.size),
+		"black":           value(g.black),
+		"white":           value(g.white),
+		"confirmed":       value(g.confirmed),
+		"blackTurn":       value(g.blackTurn),
+		"approvalLock":    value(g.approvalLock),
+		"draw":            value(g.draw),
+		"winner":          value(g.winner),
+		"winnerShare":     value(g.winnerShare),
+		"sideBets":        value(g.sideBets),
+		"proposedStake":   value(g.proposedStake),
+		"sideBetPot":      value(g.sideBetPot),
+		"getNumMoves":     value(len(g.moves)),
+		"nigiri":          unset,
+		"blackRevealed":   unset,
+		"whiteRevealed":   unset,
+		"market":          value(g.market),
+		"disputeDeadline": value(0),
+		"proposed": func([]interface{}) ([]interface{}, error) {
+			return []interface{}{g.proposed.x, g.proposed.y, g.proposed.color}, nil
+		},
+		"getMove": func(params []interface{}) ([]interface{}, error) {
+			n, err := intParam(params, 0)
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 || n >= len(g.moves) {
+				return nil, errThrow
+			}
+			m := g.moves[n]
+			return []interface{}{m.x, m.y, m.color}, nil
+		},
+		"stakes": func(params []interface{}) ([]interface{}, error) {
+			n, err := intParam(params, 0)
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 || n >= len(g.stakes) {
+				return nil, errThrow
+			}
+			return []interface{}{g.stakes[n]}, nil
+		},
+	}
+}
+
+func (g *game) confirmNewGame(sender string, value *big.Int) (err error) {
+	white := g.white
+	if white == zeroAddr && sender != g.black {
+		white = sender
+	}
+	//this.balance includes the value sent
+	balance := new(big.Int).Add(g.balance, value)
+	if g.confirmed || new(big.Int).Mul(value, big.NewInt(2)).Cmp(balance) < 0 || sender != white {
+		err = errThrow
+		return
+	}
+	g.white, g.balance = white, balance
+	g.confirmed, g.blackTurn = true, true
+	return
+}
+
+func (g *game) color(player string) int {
+	if player == g.black {
+		return black
+	}
+	return white
+}
+
+//onlyPlayers and onlyPropose
+func (g *game) onlyPropose(sender string) error {
+	if (sender != g.black && sender != g.white) || g.approvalLock ||
+		(sender == g.black && !g.blackTurn) || (sender == g.white && g.blackTurn) {
+		return errThrow
+	}
+	return nil
+}
+
+//onlyPlayers and onlyAuthorize
+func (g *game) onlyAuthorize(sender string) error {
+	if (sender != g.black && sender != g.white) || !g.approvalLock ||
+		(sender == g.black && g.blackTurn) || (sender == g.white && !g.blackTurn) {
+		return errThrow
+	}
+	return nil
+}
+
+//point reads a move's x and y params, onlySize
+func (g *game) point(params []interface{}) (x, y int, err error) {
+	if x, err = intParam(params, 0); err != nil {
+		return
+	}
+	if y, err = intParam(params, 1); err != nil {
+		return
+	}
+	if x < 0 || y < 0 || x >= g.size || y >= g.size {
+		err = errThrow
+	}
+	return
+}
+
+func (g *game) makeMove(sender string, x, y int, stake *big.Int) error {
+	if !g.sideBets && stake.Sign() > 0 {
+		return errThrow
+	}
+	g.balance.Add(g.balance, stake)
+	g.approvalLock = true
+	g.proposedStake = new(big.Int).Set(stake)
+	g.proposed = move{x, y, g.color(sender)}
+	return nil
+}
+
+//approveMove takes in the approver's matching stake, and returns the
+//proposer's stake (as a payout that doesn't end the game) if rejected
+func (g *game) approveMove(sender string, approve bool, match *big.Int) (refunds map[string]*big.Int) {
+	stake := g.proposedStake
+	g.balance.Add(g.balance, match)
+	if approve {
+		g.moves = append(g.moves, g.proposed)
+		if g.sideBets {
+			g.stakes = append(g.stakes, stake)
+			g.sideBetPot.Add(g.sideBetPot, new(big.Int).Mul(stake, big.NewInt(2)))
+		}
+		g.blackTurn = !g.blackTurn
+	} else if stake.Sign() > 0 {
+		g.balance.Sub(g.balance, stake)
+		proposer := g.black
+		if sender == g.black {
+			proposer = g.white
+		}
+		refunds = map[string]*big.Int{proposer: stake}
+	}
+	g.proposed = move{}
+	g.proposedStake = new(big.Int)
+	g.approvalLock = false
+	return
+}
+
+//settle pays out like settleGame: 1 black won, 2 white won, 3 draw
+func (g *game) settle(result int) (payouts map[string]*big.Int) {
+	g.destroyed, g.result = true, result
+	if result == 3 {
+		half := new(big.Int).Div(g.balance, big.NewInt(2))
+		return map[string]*big.Int{g.black: half, g.white: new(big.Int).Sub(g.balance, half)}
+	}
+	payout := new(big.Int).Sub(g.balance, g.sideBetPot)
+	payout.Mul(payout, big.NewInt(int64(g.winnerShare)))
+	payout.Div(payout, big.NewInt(100))
+	payout.Add(payout, g.sideBetPot)
+	rest := new(big.Int).Sub(g.balance, payout)
+	if result == black {
+		return map[string]*big.Int{g.black: payout, g.white: rest}
+	}
+	return map[string]*big.Int{g.white: payout, g.black: rest}
+}
+
+//params, decoded with UseNumber
+func intParam(params []interface{}, i int) (n int, err error) {
+	if i >= len(params) {
+		err = errors.New("missing param")
+		return
+	}
+	num, ok := params[i].(json.Number)
+	if !ok {
+		err = errors.New("param is not a number")
+		return
+	}
+	n64, err := num.Int64()
+	n = int(n64)
+	return
+}
+
+func boolParam(params []interface{}, i int) (b bool, err error) {
+	if i >= len(params) {
+		err = errors.New("missing param")
+		return
+	}
+	b, ok := params[i].(bool)
+	if !ok {
+		err = errors.New("param is not a bool")
+	}
+	return
+}
+
+func stringParam(params []interface{}, i int) (s string, err error) {
+	if i >= len(params) {
+		err = errors.New("missing param")
+		return
+	}
+	s, ok := params[i].(string)
+	if !ok {
+		err = errors.New("param is not a string")
+	}
+	return
+}
+
+func addrParam(params []interface{}, i int) (addr string, err error) {
+	addr, err = stringParam(params, i)
+	addr = normalize(addr)
+	return
+}
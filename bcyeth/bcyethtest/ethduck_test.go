@@ -0,0 +1,399 @@
+package bcyethtest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//players' keys, and their addresses
+const (
+	blackPriv   = "1111111111111111111111111111111111111111111111111111111111111111"
+	whitePriv   = "2222222222222222222222222222222222222222222222222222222222222222"
+	outsidePriv = "3333333333333333333333333333333333333333333333333333333333333333"
+	noCommit    = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+//table is a fake chain with a game on it, between black and white
+type table struct {
+	t      *testing.T
+	server *Server
+	api    bcyeth.API
+	addr   string
+	black  string
+	white  string
+}
+
+//newTable publishes a 9x9 game with black's wager, against white
+//(or an open challenge if white is ""), not yet confirmed
+func newTable(t *testing.T, white string, wager int64, winnerShare int, sideBets bool) *table {
+	t.Helper()
+	server := NewServer()
+	t.Cleanup(server.Close)
+	tb := &table{t: t, server: server, api: server.API()}
+	tb.black = addrOf(t, blackPriv)
+	tb.white = white
+	if white == "" {
+		white = zeroAddr
+	}
+	contract := bcyeth.Contract{
+		Private: blackPriv,
+		Params:  []interface{}{9, white, winnerShare, sideBets, noCommit},
+	}
+	contract.Value.SetInt64(wager)
+	result, err := tb.api.CreateContract(contract)
+	if err != nil {
+		t.Fatalf("publishing game: %v", err)
+	}
+	tb.addr = result[0].Address
+	return tb
+}
+
+func addrOf(t *testing.T, priv string) string {
+	t.Helper()
+	addr, err := bcyeth.PrivToAddr(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+//call sends a transaction to the game
+func (tb *table) call(priv string, method string, value int64, params ...interface{}) (err error) {
+	contract := bcyeth.Contract{Private: priv, Params: params}
+	contract.Value.SetInt64(value)
+	_, err = tb.api.CallContract(contract, tb.addr, method)
+	return
+}
+
+//mustCall sends a transaction that shouldn't throw
+func (tb *table) mustCall(priv string, method string, value int64, params ...interface{}) {
+	tb.t.Helper()
+	if err := tb.call(priv, method, value, params...); err != nil {
+		tb.t.Fatalf("%s: %v", method, err)
+	}
+}
+
+//mustThrow sends a transaction the contract should reject
+func (tb *table) mustThrow(priv string, method string, value int64, params ...interface{}) {
+	tb.t.Helper()
+	err := tb.call(priv, method, value, params...)
+	var apiErr *bcyeth.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		tb.t.Fatalf("%s should throw, got %v", method, err)
+	}
+}
+
+//get calls a getter, returning its first result as a string
+func (tb *table) get(method string, params ...interface{}) string {
+	tb.t.Helper()
+	result, err := tb.api.CallContract(bcyeth.Contract{Private: outsidePriv, Params: params}, tb.addr, method)
+	if err != nil {
+		tb.t.Fatalf("%s: %v", method, err)
+	}
+	if len(result.Results) == 0 {
+		tb.t.Fatalf("%s returned nothing", method)
+	}
+	return toString(result.Results[0])
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case string:
+		return v
+	default:
+		b, _ := v.(interface{ String() string })
+		if b == nil {
+			return ""
+		}
+		return b.String()
+	}
+}
+
+//confirm has white match black's wager
+func (tb *table) confirm(wager int64) {
+	tb.t.Helper()
+	tb.mustCall(whitePriv, "confirmNewGame", wager)
+}
+
+//play has the player propose a move, and the opponent approve it
+func (tb *table) play(proposer, approver string, x, y int) {
+	tb.t.Helper()
+	tb.mustCall(proposer, "proposeMove", 0, x, y)
+	tb.mustCall(approver, "authorizeMove", 0, true)
+}
+
+func (tb *table) balance(addr string) int64 {
+	return tb.server.Balance(addr).Int64()
+}
+
+//gone reports whether the game self-destructed
+func (tb *table) gone() bool {
+	_, err := tb.api.GetContract(tb.addr)
+	return bcyeth.IsNotFound(err)
+}
+
+func TestConfirmNewGame(t *testing.T) {
+	white := addrOf(t, whitePriv)
+	tb := newTable(t, white, 1000, 75, false)
+	//white has to match black's wager, and only white can confirm
+	tb.mustThrow(whitePriv, "confirmNewGame", 999)
+	tb.mustThrow(outsidePriv, "confirmNewGame", 1000)
+	tb.mustThrow(blackPriv, "confirmNewGame", 1000)
+	if tb.get("confirmed") != "false" {
+		t.Fatal("game confirmed before white matched the wager")
+	}
+	tb.confirm(1000)
+	if tb.get("confirmed") != "true" || tb.get("blackTurn") != "true" {
+		t.Fatal("confirmed game should be black's turn")
+	}
+	if got := tb.balance(tb.addr); got != 2000 {
+		t.Fatalf("pot is %d, want 2000", got)
+	}
+	tb.mustThrow(whitePriv, "confirmNewGame", 1000)
+}
+
+func TestConfirmOpenChallenge(t *testing.T) {
+	tb := newTable(t, "", 1000, 75, false)
+	//black can't accept their own challenge
+	tb.mustThrow(blackPriv, "confirmNewGame", 1000)
+	tb.confirm(1000)
+	if got, want := tb.get("white"), addrOf(t, whitePriv); got != want {
+		t.Fatalf("white is %s, want whoever confirmed, %s", got, want)
+	}
+	tb.mustThrow(outsidePriv, "confirmNewGame", 1000)
+}
+
+func TestMoveOrdering(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 75, false)
+	//no moves until white confirms
+	tb.mustThrow(blackPriv, "proposeMove", 0, 2, 3)
+	tb.confirm(1000)
+	//black moves first
+	tb.mustThrow(whitePriv, "proposeMove", 0, 2, 3)
+	tb.mustCall(blackPriv, "proposeMove", 0, 2, 3)
+	//a proposed move locks out new proposals until it's authorized,
+	//and only the opponent can authorize it
+	tb.mustThrow(blackPriv, "proposeMove", 0, 4, 4)
+	tb.mustThrow(whitePriv, "proposeMove", 0, 4, 4)
+	tb.mustThrow(blackPriv, "authorizeMove", 0, true)
+	if tb.get("getNumMoves") != "0" {
+		t.Fatal("move added before it was authorized")
+	}
+	tb.mustCall(whitePriv, "authorizeMove", 0, true)
+	if tb.get("getNumMoves") != "1" || tb.get("blackTurn") != "false" {
+		t.Fatal("authorized move should be added, and make it white's turn")
+	}
+	if x, y, color := tb.get("getMove", 0), tb.getN("getMove", 1, 0), tb.getN("getMove", 2, 0); x != "2" || y != "3" || color != "1" {
+		t.Fatalf("move 0 is %s,%s color %s, want 2,3 black", x, y, color)
+	}
+	//a rejected move isn't added, and it stays the proposer's turn
+	tb.mustCall(whitePriv, "proposeMove", 0, 5, 5)
+	tb.mustCall(blackPriv, "authorizeMove", 0, false)
+	if tb.get("getNumMoves") != "1" || tb.get("blackTurn") != "false" || tb.get("approvalLock") != "false" {
+		t.Fatal("rejected move should leave white to propose again")
+	}
+	tb.play(whitePriv, blackPriv, 5, 6)
+	if tb.get("getNumMoves") != "2" || tb.get("blackTurn") != "true" {
+		t.Fatal("white's approved move should make it black's turn")
+	}
+}
+
+//getN is like get, returning the n-th result
+func (tb *table) getN(method string, n int, params ...interface{}) string {
+	tb.t.Helper()
+	result, err := tb.api.CallContract(bcyeth.Contract{Private: outsidePriv, Params: params}, tb.addr, method)
+	if err != nil {
+		tb.t.Fatalf("%s: %v", method, err)
+	}
+	if len(result.Results) <= n {
+		tb.t.Fatalf("%s returned %d results, want %d", method, len(result.Results), n+1)
+	}
+	return toString(result.Results[n])
+}
+
+func TestModifierRejections(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 75, false)
+	tb.confirm(1000)
+	//onlyPlayers
+	tb.mustThrow(outsidePriv, "proposeMove", 0, 1, 1)
+	tb.mustThrow(outsidePriv, "proposeWinner", 0)
+	tb.mustThrow(outsidePriv, "proposeDraw", 0)
+	//onlySize
+	tb.mustThrow(blackPriv, "proposeMove", 0, 9, 0)
+	tb.mustThrow(blackPriv, "proposeMove", 0, 0, 9)
+	//onlyAuthorize, with nothing proposed
+	tb.mustThrow(whitePriv, "authorizeMove", 0, true)
+	tb.mustThrow(whitePriv, "authorizeWinner", 0, true)
+	//onlyPropose, on the opponent's turn
+	tb.mustThrow(whitePriv, "proposeWinner", 0)
+	tb.mustThrow(whitePriv, "proposeDraw", 0)
+	//side bets are off, so moves can't carry value
+	tb.mustThrow(blackPriv, "proposeMove", 5, 1, 1)
+	//and methods that aren't payable take none
+	tb.mustThrow(blackPriv, "proposeDraw", 5)
+	tb.mustCall(blackPriv, "proposeMove", 0, 1, 1)
+	tb.mustThrow(outsidePriv, "authorizeMove", 0, true)
+}
+
+func TestRefundGame(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 75, false)
+	//only black can refund
+	tb.mustCall(whitePriv, "refundGame", 0)
+	tb.mustCall(outsidePriv, "refundGame", 0)
+	if tb.gone() {
+		t.Fatal("game refunded by someone other than black")
+	}
+	tb.mustCall(blackPriv, "refundGame", 0)
+	if !tb.gone() {
+		t.Fatal("refunded game should self-destruct")
+	}
+	if got := tb.balance(tb.black); got != 1000 {
+		t.Fatalf("black got %d back, want their 1000 wager", got)
+	}
+}
+
+func TestRefundConfirmedGame(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 75, false)
+	tb.confirm(1000)
+	tb.mustCall(blackPriv, "refundGame", 0)
+	if tb.gone() || tb.balance(tb.black) != 0 {
+		t.Fatal("a confirmed game can't be refunded")
+	}
+}
+
+func TestWinnerPayouts(t *testing.T) {
+	for _, c := range []struct {
+		share        int
+		winner       string
+		winnerPayout int64
+		loserPayout  int64
+	}{
+		{75, blackPriv, 1500, 500},
+		{100, blackPriv, 2000, 0},
+		{50, blackPriv, 1000, 1000},
+		{75, whitePriv, 1500, 500},
+	} {
+		tb := newTable(t, addrOf(t, whitePriv), 1000, c.share, false)
+		tb.white = addrOf(t, whitePriv)
+		tb.confirm(1000)
+		winner, loser := tb.black, tb.white
+		loserPriv := whitePriv
+		if c.winner == whitePriv {
+			//it has to be white's turn for white to propose they won
+			tb.play(blackPriv, whitePriv, 0, 0)
+			winner, loser, loserPriv = tb.white, tb.black, blackPriv
+		}
+		tb.mustCall(c.winner, "proposeWinner", 0)
+		//the winner can't approve their own proposal
+		tb.mustThrow(c.winner, "authorizeWinner", 0, true)
+		tb.mustCall(loserPriv, "authorizeWinner", 0, true)
+		if !tb.gone() {
+			t.Fatalf("share %d: settled game should self-destruct", c.share)
+		}
+		if got := tb.balance(winner); got != c.winnerPayout {
+			t.Errorf("share %d: winner got %d, want %d", c.share, got, c.winnerPayout)
+		}
+		if got := tb.balance(loser); got != c.loserPayout {
+			t.Errorf("share %d: loser got %d, want %d", c.share, got, c.loserPayout)
+		}
+	}
+}
+
+func TestRejectWinner(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 75, false)
+	tb.confirm(1000)
+	tb.mustCall(blackPriv, "proposeWinner", 0)
+	tb.mustCall(whitePriv, "authorizeWinner", 0, false)
+	if tb.gone() || tb.get("winner") != "0" || tb.get("approvalLock") != "false" {
+		t.Fatal("rejecting a winner should reset it, and keep playing")
+	}
+	//it's still black's turn
+	tb.play(blackPriv, whitePriv, 0, 0)
+}
+
+func TestSideBetPayouts(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 50, true)
+	tb.white = addrOf(t, whitePriv)
+	tb.confirm(1000)
+	//the approver has to match the stake exactly
+	tb.mustCall(blackPriv, "proposeMove", 100, 0, 0)
+	tb.mustThrow(whitePriv, "authorizeMove", 99, true)
+	tb.mustCall(whitePriv, "authorizeMove", 100, true)
+	if tb.get("sideBetPot") != "200" {
+		t.Fatalf("side bet pot is %s, want 200", tb.get("sideBetPot"))
+	}
+	//a rejected stake goes back to its proposer
+	tb.mustCall(whitePriv, "proposeMove", 50, 1, 1)
+	tb.mustCall(blackPriv, "authorizeMove", 0, false)
+	if got := tb.balance(tb.white); got != 50 {
+		t.Fatalf("white got %d of their rejected stake back, want 50", got)
+	}
+	tb.mustCall(whitePriv, "proposeWinner", 0)
+	tb.mustCall(blackPriv, "authorizeWinner", 0, true)
+	//the winner takes their share of the wagers, and the whole side bet pot
+	if got := tb.balance(tb.white); got != 50+1000+200 {
+		t.Errorf("white got %d, want 1250", got)
+	}
+	if got := tb.balance(tb.black); got != 1000 {
+		t.Errorf("black got %d, want 1000", got)
+	}
+}
+
+func TestDrawPayout(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 90, false)
+	tb.white = addrOf(t, whitePriv)
+	tb.confirm(1000)
+	tb.mustCall(blackPriv, "proposeDraw", 0)
+	tb.mustCall(whitePriv, "authorizeDraw", 0, false)
+	if tb.gone() || tb.get("draw") != "false" {
+		t.Fatal("rejecting a draw should keep playing")
+	}
+	tb.mustCall(blackPriv, "proposeDraw", 0)
+	tb.mustCall(whitePriv, "authorizeDraw", 0, true)
+	if !tb.gone() {
+		t.Fatal("drawn game should self-destruct")
+	}
+	//a draw splits the pot whatever the winner's share
+	if tb.balance(tb.black) != 1000 || tb.balance(tb.white) != 1000 {
+		t.Fatalf("draw paid black %d and white %d, want 1000 each", tb.balance(tb.black), tb.balance(tb.white))
+	}
+}
+
+func TestHostileMarket(t *testing.T) {
+	tb := newTable(t, addrOf(t, whitePriv), 1000, 100, false)
+	tb.white = addrOf(t, whitePriv)
+	//any contract can be attached as the market; another game throws
+	//when it's told to settle, since it has no settle method
+	contract := bcyeth.Contract{Private: outsidePriv, Params: []interface{}{9, zeroAddr, 75, false, noCommit}}
+	result, err := tb.api.CreateContract(contract)
+	if err != nil {
+		t.Fatalf("publishing hostile market: %v", err)
+	}
+	hostile := result[0].Address
+	//markets only go on confirmed games, and only players attach them
+	tb.mustThrow(whitePriv, "setMarket", 0, hostile)
+	tb.confirm(1000)
+	tb.mustThrow(outsidePriv, "setMarket", 0, hostile)
+	//the loser-to-be attaches it, hoping to lock the pot
+	tb.mustCall(whitePriv, "setMarket", 0, hostile)
+	if got := tb.get("market"); got != hostile {
+		t.Fatalf("market is %s, want %s", got, hostile)
+	}
+	tb.mustThrow(blackPriv, "setMarket", 0, hostile)
+	tb.mustCall(blackPriv, "proposeWinner", 0)
+	tb.mustCall(whitePriv, "authorizeWinner", 0, true)
+	if !tb.gone() {
+		t.Fatal("game should settle even though its market throws")
+	}
+	if got := tb.balance(tb.black); got != 2000 {
+		t.Fatalf("black got %d, want the 2000 pot", got)
+	}
+}
@@ -0,0 +1,483 @@
+//Package bcyethtest is an in-memory fake of the parts of BlockCypher's
+//Ethereum API that ethduck uses, so the web flow can be exercised offline.
+//Every contract it publishes runs a simple EthDuck state machine in place
+//of ethduck.sol, and calls take effect immediately instead of waiting to
+//be mined. Senders have unlimited funds; only what contracts pay out,
+//and what the faucet sends, is tracked in balances.
+//
+//	fake := bcyethtest.NewServer()
+//	defer fake.Close()
+//	bcy := fake.API()
+package bcyethtest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+//Server is a fake BlockCypher, serving these under any /{coin}/{chain}
+//
+//	POST /contracts
+//	GET  /contracts/{addr}
+//	POST /contracts/{addr}/{method}
+//	GET  /addrs/{addr}/balance
+//	GET  /addrs/{addr}
+//	GET  /addrs/{addr}/full
+//	POST /addrs
+//	POST /faucet
+//	GET  /txs/{hash}
+//	POST /hooks
+//	GET  /hooks
+//	GET  /hooks/{id}
+//	DELETE /hooks/{id}
+//
+//and the event stream under any /socket/{coin}/{chain}.
+//
+//Every transaction (creating a game, or calling a method that isn't
+//constant) is mined straight away in a block of its own, and sent to
+//the hooks and event stream subscriptions for its addresses or hash
+//(for any transaction event but unconfirmed-tx and double-spend-tx),
+//or for new blocks.
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	games    map[string]*game
+	balances map[string]*big.Int
+	created  int
+	//transactions by address, oldest first, and the latest block
+	txs    map[string][]bcyeth.TX
+	height int
+	hooks  map[string]bcyeth.Hook
+	hooked int
+	//event stream connections
+	streams map[*stream]bool
+}
+
+//NewServer starts a fake BlockCypher, call Close when done with it
+func NewServer() *Server {
+	s := &Server{
+		games:    make(map[string]*game),
+		balances: make(map[string]*big.Int),
+		txs:      make(map[string][]bcyeth.TX),
+		hooks:    make(map[string]bcyeth.Hook),
+		streams:  make(map[*stream]bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/contracts", s.createHandler)
+	mux.HandleFunc("/contracts/", s.contractHandler)
+	mux.HandleFunc("/addrs/", s.addrHandler)
+	mux.HandleFunc("/addrs", s.genAddrHandler)
+	mux.HandleFunc("/faucet", s.faucetHandler)
+	mux.HandleFunc("/txs/", s.txHandler)
+	mux.HandleFunc("/hooks", s.hooksHandler)
+	mux.HandleFunc("/hooks/", s.hookHandler)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/socket/") {
+			s.streamHandler(w, r)
+			return
+		}
+		//drop the coin and chain
+		parts := strings.SplitN(r.URL.Path, "/", 4)
+		if len(parts) < 4 {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		r.URL.Path = "/" + parts[3]
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+//API returns a bcyeth.API pointed at the fake, on BlockCypher's testnet
+func (s *Server) API() bcyeth.API {
+	api := bcyeth.NewTest("")
+	api.BaseURL = s.URL
+	api.SocketURL = "ws" + strings.TrimPrefix(s.URL, "http") + "/socket"
+	return api
+}
+
+//Balance is what an address holds: a game's pot,
+//or what a player has been paid out
+func (s *Server) Balance(addr string) *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balance(normalize(addr))
+}
+
+func (s *Server) balance(addr string) *big.Int {
+	if g, ok := s.games[addr]; ok {
+		return new(big.Int).Set(g.balance)
+	}
+	if bal, ok := s.balances[addr]; ok {
+		return new(big.Int).Set(bal)
+	}
+	return new(big.Int)
+}
+
+//createHandler publishes a game; params are EthDuck's constructor's
+func (s *Server) createHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	contract, sender, err := decodeContract(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	g, err := newGame(sender, contract.Params, &contract.Value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.created++
+	sum := sha256.Sum256([]byte("bcyethtest contract " + strconv.Itoa(s.created)))
+	addr := hex.EncodeToString(sum[:20])
+	s.games[addr] = g
+	hash := s.mine(sender, addr, &contract.Value)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, []bcyeth.Contract{{Address: addr, CreationTXHash: hash}})
+}
+
+//contractHandler gets a contract, or calls one of its methods
+func (s *Server) contractHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/contracts/"), "/")
+	addr := normalize(parts[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[addr]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Contract "+addr+" not found")
+		return
+	}
+	if len(parts) == 1 && r.Method == "GET" {
+		writeJSON(w, http.StatusOK, &bcyeth.Contract{Address: addr})
+		return
+	}
+	if len(parts) != 2 || r.Method != "POST" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	contract, sender, err := decodeContract(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, payouts, err := g.call(sender, parts[1], contract.Params, &contract.Value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var hash string
+	if !g.constant(parts[1]) {
+		hash = s.mine(sender, addr, &contract.Value)
+	}
+	for to, value := range payouts {
+		s.balances[to] = new(big.Int).Add(s.balance(to), value)
+	}
+	if g.destroyed {
+		//like settleMarket, a market that throws is ignored; the fake's
+		//only contracts are games, which don't have a settle method
+		if m, ok := s.games[g.market]; ok {
+			m.call(addr, "settle", []interface{}{g.result}, new(big.Int))
+		}
+		delete(s.games, addr)
+	}
+	writeJSON(w, http.StatusOK, &bcyeth.Contract{Address: addr, Results: results, CallTXHash: hash})
+}
+
+//mine records a transaction from one address to another in a new block,
+//returning its hash
+func (s *Server) mine(from string, to string, value *big.Int) (hash string) {
+	s.height++
+	sum := sha256.Sum256([]byte("bcyethtest tx " + strconv.Itoa(s.height)))
+	tx := bcyeth.TX{
+		BlockHeight: s.height,
+		Hash:        hex.EncodeToString(sum[:]),
+		Addresses:   []string{from, to},
+		GasLimit:    100000,
+		Confirmed:   time.Now(),
+		Received:    time.Now(),
+		Inputs:      []bcyeth.TXInput{{Addresses: []string{from}}},
+		Outputs:     []bcyeth.TXOutput{{Addresses: []string{to}}},
+	}
+	tx.Total.Set(value)
+	tx.Outputs[0].Value.Set(value)
+	s.txs[from] = append(s.txs[from], tx)
+	s.txs[to] = append(s.txs[to], tx)
+	tx.Confirmations = 1
+	block := bcyeth.Block{Hash: tx.Hash, Height: s.height, Chain: "BETH.test", Time: tx.Confirmed, NTx: 1}
+	for _, hook := range s.hooks {
+		if hook.Event == bcyeth.NewBlock {
+			go deliver(hook.URL, &block)
+		} else if matches(hook.Event, hook.Address, hook.Hash, tx) {
+			go deliver(hook.URL, &tx)
+		}
+	}
+	for stream := range s.streams {
+		go stream.mined(&block, &tx)
+	}
+	return tx.Hash
+}
+
+//matches reports whether a hook or subscription is for a transaction,
+//which is always mined by the time it's sent out
+func matches(event string, address string, hash string, tx bcyeth.TX) bool {
+	if event == bcyeth.NewBlock || event == bcyeth.DoubleSpendTX || event == bcyeth.UnconfirmedTX {
+		return false
+	}
+	if address != "" && normalize(address) != tx.Inputs[0].Addresses[0] && normalize(address) != tx.Outputs[0].Addresses[0] {
+		return false
+	}
+	return hash == "" || normalize(hash) == tx.Hash
+}
+
+//deliver posts a transaction or block to a hook's URL, like BlockCypher does
+func deliver(url string, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+//hooksHandler creates a hook, or lists them all
+func (s *Server) hooksHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == "GET" {
+		hooks := []bcyeth.Hook{}
+		for _, hook := range s.hooks {
+			hooks = append(hooks, hook)
+		}
+		writeJSON(w, http.StatusOK, hooks)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var hook bcyeth.Hook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if hook.Event == "" || hook.URL == "" {
+		writeError(w, http.StatusBadRequest, "Hook needs an event and a url")
+		return
+	}
+	s.hooked++
+	hook.ID = "bcyethtest-hook-" + strconv.Itoa(s.hooked)
+	s.hooks[hook.ID] = hook
+	writeJSON(w, http.StatusCreated, &hook)
+}
+
+//hookHandler gets or deletes a hook
+func (s *Server) hookHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/hooks/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hook, ok := s.hooks[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Hook "+id+" not found")
+		return
+	}
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, &hook)
+	case "DELETE":
+		delete(s.hooks, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+//addrHandler serves an address's balance, and its transactions
+//newest first, paged with before and limit
+func (s *Server) addrHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/addrs/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "balance" && parts[1] != "full") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	addr := normalize(parts[0])
+	full := len(parts) == 2 && parts[1] == "full"
+	limit := 50
+	if full {
+		limit = 10
+	}
+	if l, err := strconv.Atoi(r.FormValue("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	before, err := strconv.Atoi(r.FormValue("before"))
+	if err != nil {
+		before = -1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var a bcyeth.Addr
+	a.Address = addr
+	bal := s.balance(addr)
+	a.Balance.Set(bal)
+	a.FinalBalance.Set(bal)
+	txs := s.txs[addr]
+	a.NTx, a.FinalNTx = len(txs), len(txs)
+	if len(parts) == 2 && parts[1] == "balance" {
+		writeJSON(w, http.StatusOK, &a)
+		return
+	}
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+		if before >= 0 && tx.BlockHeight >= before {
+			continue
+		}
+		if len(a.TXs)+len(a.TXRefs) == limit {
+			a.HasMore = true
+			break
+		}
+		tx.Confirmations = s.height - tx.BlockHeight + 1
+		if full {
+			a.TXs = append(a.TXs, tx)
+			continue
+		}
+		ref := bcyeth.TXRef{
+			BlockHeight:   tx.BlockHeight,
+			TXHash:        tx.Hash,
+			TXInputN:      -1,
+			TXOutputN:     -1,
+			Confirmations: tx.Confirmations,
+			Confirmed:     tx.Confirmed,
+		}
+		if tx.Outputs[0].Addresses[0] == addr {
+			ref.TXOutputN = 0
+		} else {
+			ref.TXInputN = 0
+		}
+		ref.Value.Set(&tx.Total)
+		a.TXRefs = append(a.TXRefs, ref)
+	}
+	writeJSON(w, http.StatusOK, &a)
+}
+
+//txHandler serves a transaction by its hash
+func (s *Server) txHandler(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/txs/"), "0x")
+	if r.Method != "GET" || strings.Contains(hash, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, txs := range s.txs {
+		for _, tx := range txs {
+			if tx.Hash == hash {
+				tx.Confirmations = s.height - tx.BlockHeight + 1
+				writeJSON(w, http.StatusOK, &tx)
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "Transaction "+hash+" not found")
+}
+
+//genAddrHandler generates a keypair
+func (s *Server) genAddrHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	priv, pub := btcec.PrivKeyFromBytes(raw)
+	pair := bcyeth.AddrKeychain{
+		Private: hex.EncodeToString(priv.Serialize()),
+		Public:  hex.EncodeToString(pub.SerializeUncompressed()),
+	}
+	var err error
+	if pair.Address, err = bcyeth.PrivToAddr(pair.Private); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, &pair)
+}
+
+//faucetHandler credits an address, like the testnet faucet
+func (s *Server) faucetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		Address string  `json:"address"`
+		Amount  big.Int `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Amount.Sign() <= 0 {
+		writeError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	}
+	addr := normalize(req.Address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[addr] = new(big.Int).Add(s.balance(addr), &req.Amount)
+	hash := s.mine(zeroAddr, addr, &req.Amount)
+	writeJSON(w, http.StatusOK, &struct {
+		TXRef string `json:"tx_ref"`
+	}{hash})
+}
+
+//decodeContract decodes a request's contract, and the address of its private key
+func decodeContract(r *http.Request) (contract bcyeth.Contract, sender string, err error) {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err = dec.Decode(&contract); err != nil {
+		return
+	}
+	sender, err = bcyeth.PrivToAddr(contract.Private)
+	return
+}
+
+func normalize(addr string) string {
+	return strings.ToLower(strings.TrimPrefix(addr, "0x"))
+}
+
+//writeJSON writes v, which should be a pointer (or slice) so
+//big.Int fields are encoded as numbers
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+//writeError writes an error the way BlockCypher does
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{msg})
+}
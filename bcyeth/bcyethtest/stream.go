@@ -0,0 +1,78 @@
+package bcyethtest
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{}
+
+//stream is an event stream connection, and what it subscribed to
+type stream struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+	subs []bcyeth.Subscription
+}
+
+//streamHandler serves the event stream: every message from the
+//client subscribes to an event, except pings, which get a pong
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	st := &stream{conn: conn}
+	s.mu.Lock()
+	s.streams[st] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, st)
+		s.mu.Unlock()
+	}()
+	for {
+		var sub bcyeth.Subscription
+		if err := conn.ReadJSON(&sub); err != nil {
+			return
+		}
+		st.mu.Lock()
+		if sub.Event == "ping" {
+			err = conn.WriteJSON(&bcyeth.Subscription{Event: "pong"})
+		} else {
+			st.subs = append(st.subs, sub)
+		}
+		st.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+//mined sends a new block and its transaction to the stream,
+//once for each subscription they match
+func (st *stream) mined(block *bcyeth.Block, tx *bcyeth.TX) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, sub := range st.subs {
+		if sub.Event == bcyeth.NewBlock {
+			st.conn.WriteJSON(block)
+		} else if matches(sub.Event, sub.Address, sub.Hash, *tx) {
+			st.conn.WriteJSON(tx)
+		}
+	}
+}
+
+//DropStreams closes every event stream connection, as BlockCypher
+//sometimes does, so clients have to reconnect
+func (s *Server) DropStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for st := range s.streams {
+		st.conn.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package bcyethtest
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//waitFor polls cond until it's true, or fails the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamReconnect(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	api := server.API()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := api.NewStream(ctx)
+	//the stream doesn't count as connected until its callbacks are done
+	reconnects := make(chan bool, 1)
+	stream.OnReconnect(func() { reconnects <- stream.Connected() })
+	blocks := stream.Subscribe(ctx, bcyeth.Subscription{Event: bcyeth.NewBlock})
+	waitFor(t, "the stream connects", stream.Connected)
+	select {
+	case <-reconnects:
+		t.Fatal("first connection counted as a reconnect")
+	default:
+	}
+	server.DropStreams()
+	select {
+	case connected := <-reconnects:
+		if connected {
+			t.Fatal("stream counted as connected before its reconnect callbacks were done")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dropped stream never reconnected")
+	}
+	waitFor(t, "the stream reconnects", stream.Connected)
+	if stream.Err() != nil {
+		t.Fatalf("reconnected stream has an error: %v", stream.Err())
+	}
+	//subscriptions carry over to the new connection
+	if _, err := api.Faucet(addrOf(t, blackPriv), *big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-blocks:
+		if ev.Block == nil {
+			t.Fatal("new-block event without a block")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no block after reconnecting")
+	}
+}
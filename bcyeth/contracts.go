@@ -1,48 +1,77 @@
 package bcyeth
 
 import (
+	"context"
+	"encoding/json"
 	"math/big"
 	"time"
 )
 
 type Contract struct {
-	Solidity       string        `json:"solidity,omitempty"`
-	Params         []interface{} `json:"params,omitempty"`
-	Publish        []string      `json:"publish,omitempty"`
-	Private        string        `json:"private,omitempty"`
-	GasLimit       int           `json:"gas_limit,omitempty"`
-	Value          big.Int       `json:"value,omitempty"`
-	Name           string        `json:"name,omitempty"`
-	Bin            string        `json:"bin,omitempty"`
-	Address        string        `json:"address,omitempty"`
-	Created        time.Time     `json:"created,omitempty"`
-	CreationTXHash string        `json:"creation_tx_hash,omitempty"`
-	Results        []interface{} `json:"results,omitempty"`
+	Solidity       string          `json:"solidity,omitempty"`
+	Params         []interface{}   `json:"params,omitempty"`
+	Publish        []string        `json:"publish,omitempty"`
+	Private        string          `json:"private,omitempty"`
+	GasLimit       int             `json:"gas_limit,omitempty"`
+	Value          big.Int         `json:"value,omitempty"`
+	Name           string          `json:"name,omitempty"`
+	Bin            string          `json:"bin,omitempty"`
+	ABI            json.RawMessage `json:"abi,omitempty"`
+	Address        string          `json:"address,omitempty"`
+	Created        time.Time       `json:"created,omitempty"`
+	CreationTXHash string          `json:"creation_tx_hash,omitempty"`
+	CallTXHash     string          `json:"call_tx_hash,omitempty"`
+	Results        []interface{}   `json:"results,omitempty"`
+}
+
+//TXHash is the hash of the transaction that created the contract,
+//or of a method call's transaction; calls to constant methods
+//aren't transactions, so they have none
+func (c Contract) TXHash() string {
+	if c.CallTXHash != "" {
+		return c.CallTXHash
+	}
+	return c.CreationTXHash
 }
 
 func (api *API) CreateContract(contract Contract) (result []Contract, err error) {
+	return api.CreateContractContext(context.Background(), contract)
+}
+
+//CreateContractContext is CreateContract, but gives up when ctx is done
+func (api *API) CreateContractContext(ctx context.Context, contract Contract) (result []Contract, err error) {
 	u, err := api.buildURL("/contracts", nil)
 	if err != nil {
 		return
 	}
-	err = postResponse(u, &contract, &result)
+	err = api.postResponse(ctx, u, &contract, &result)
 	return
 }
 
 func (api *API) GetContract(address string) (result Contract, err error) {
+	return api.GetContractContext(context.Background(), address)
+}
+
+//GetContractContext is GetContract, but gives up when ctx is done
+func (api *API) GetContractContext(ctx context.Context, address string) (result Contract, err error) {
 	u, err := api.buildURL("/contracts/"+address, nil)
 	if err != nil {
 		return
 	}
-	err = getResponse(u, &result)
+	err = api.getResponse(ctx, u, &result)
 	return
 }
 
 func (api *API) CallContract(contract Contract, address string, method string) (result Contract, err error) {
+	return api.CallContractContext(context.Background(), contract, address, method)
+}
+
+//CallContractContext is CallContract, but gives up when ctx is done
+func (api *API) CallContractContext(ctx context.Context, contract Contract, address string, method string) (result Contract, err error) {
 	u, err := api.buildURL("/contracts/"+address+"/"+method, nil)
 	if err != nil {
 		return
 	}
-	err = postResponse(u, &contract, &result)
+	err = api.postResponse(ctx, u, &contract, &result)
 	return
 }
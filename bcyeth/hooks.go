@@ -0,0 +1,91 @@
+package bcyeth
+
+import "context"
+
+//events a Hook can be for
+const (
+	//UnconfirmedTX is any new transaction, before it's mined
+	UnconfirmedTX = "unconfirmed-tx"
+	//NewBlock is every new block
+	NewBlock = "new-block"
+	//ConfirmedTX is any transaction as it's mined
+	ConfirmedTX = "confirmed-tx"
+	//TXConfirmation is each new confirmation of a transaction,
+	//up to Confirmations
+	TXConfirmation = "tx-confirmation"
+	//DoubleSpendTX is a transaction spending the same nonce as another
+	DoubleSpendTX = "double-spend-tx"
+)
+
+//Hook is a WebHook: BlockCypher POSTs to URL whenever Event happens,
+//for transactions of Address or with Hash if either is set. Transaction
+//events are sent the TX as JSON, new blocks the block.
+//BlockCypher needs a token to create hooks, see API.Token
+type Hook struct {
+	ID             string `json:"id,omitempty"`
+	Event          string `json:"event"`
+	URL            string `json:"url"`
+	Address        string `json:"address,omitempty"`
+	Hash           string `json:"hash,omitempty"`
+	Confirmations  int    `json:"confirmations,omitempty"`
+	Token          string `json:"token,omitempty"`
+	CallbackErrors int    `json:"callback_errors,omitempty"`
+}
+
+//CreateHook registers a Hook, returning it with its ID
+func (api *API) CreateHook(hook Hook) (result Hook, err error) {
+	return api.CreateHookContext(context.Background(), hook)
+}
+
+//CreateHookContext is CreateHook, but gives up when ctx is done
+func (api *API) CreateHookContext(ctx context.Context, hook Hook) (result Hook, err error) {
+	u, err := api.buildURL("/hooks", nil)
+	if err != nil {
+		return
+	}
+	err = api.postResponse(ctx, u, &hook, &result)
+	return
+}
+
+//ListHooks returns every Hook registered with the API's token
+func (api *API) ListHooks() (hooks []Hook, err error) {
+	return api.ListHooksContext(context.Background())
+}
+
+//ListHooksContext is ListHooks, but gives up when ctx is done
+func (api *API) ListHooksContext(ctx context.Context) (hooks []Hook, err error) {
+	u, err := api.buildURL("/hooks", nil)
+	if err != nil {
+		return
+	}
+	err = api.getResponse(ctx, u, &hooks)
+	return
+}
+
+func (api *API) GetHook(id string) (hook Hook, err error) {
+	return api.GetHookContext(context.Background(), id)
+}
+
+//GetHookContext is GetHook, but gives up when ctx is done
+func (api *API) GetHookContext(ctx context.Context, id string) (hook Hook, err error) {
+	u, err := api.buildURL("/hooks/"+id, nil)
+	if err != nil {
+		return
+	}
+	err = api.getResponse(ctx, u, &hook)
+	return
+}
+
+func (api *API) DeleteHook(id string) (err error) {
+	return api.DeleteHookContext(context.Background(), id)
+}
+
+//DeleteHookContext is DeleteHook, but gives up when ctx is done
+func (api *API) DeleteHookContext(ctx context.Context, id string) (err error) {
+	u, err := api.buildURL("/hooks/"+id, nil)
+	if err != nil {
+		return
+	}
+	err = api.deleteResponse(ctx, u)
+	return
+}
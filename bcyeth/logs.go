@@ -0,0 +1,264 @@
+package bcyeth
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+//Log is a contract event log, as returned by an Ethereum
+//node's eth_getLogs. BlockCypher doesn't serve logs, so
+//they're fetched over JSON-RPC instead.
+type Log struct {
+	Address     string   `json:"address"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+	BlockNumber string   `json:"blockNumber"`
+	TXHash      string   `json:"transactionHash"`
+	LogIndex    string   `json:"logIndex"`
+}
+
+//Block returns the log's block number
+func (l Log) Block() (block int64, err error) {
+	return strconv.ParseInt(strings.TrimPrefix(l.BlockNumber, "0x"), 16, 64)
+}
+
+//GetLogs fetches every log of a contract address from
+//the Ethereum JSON-RPC endpoint at rpcURL
+func GetLogs(rpcURL string, address string) (logs []Log, err error) {
+	return GetLogsContext(context.Background(), http.DefaultClient, rpcURL, address)
+}
+
+//GetLogsContext is GetLogs through client (http.DefaultClient if nil),
+//giving up when ctx is done
+func GetLogsContext(ctx context.Context, client *http.Client, rpcURL string, address string) (logs []Log, err error) {
+	type filter struct {
+		Address   string `json:"address"`
+		FromBlock string `json:"fromBlock"`
+		ToBlock   string `json:"toBlock"`
+	}
+	params := []interface{}{filter{"0x" + strings.TrimPrefix(address, "0x"), "earliest", "latest"}}
+	err = rpcCall(ctx, client, rpcURL, "eth_getLogs", params, &logs)
+	return
+}
+
+//GetTXLogs fetches the logs of a mined transaction, from its receipt
+func GetTXLogs(rpcURL string, hash string) (logs []Log, err error) {
+	return GetTXLogsContext(context.Background(), http.DefaultClient, rpcURL, hash)
+}
+
+//GetTXLogsContext is GetTXLogs through client (http.DefaultClient if nil),
+//giving up when ctx is done; a transaction that isn't mined yet is an error
+func GetTXLogsContext(ctx context.Context, client *http.Client, rpcURL string, hash string) (logs []Log, err error) {
+	var receipt *struct {
+		Logs []Log `json:"logs"`
+	}
+	err = rpcCall(ctx, client, rpcURL, "eth_getTransactionReceipt", []interface{}{"0x" + strings.TrimPrefix(hash, "0x")}, &receipt)
+	if err != nil {
+		return
+	}
+	if receipt == nil {
+		err = errors.New("bcyeth: no receipt for " + hash + ", it isn't mined yet")
+		return
+	}
+	logs = receipt.Logs
+	return
+}
+
+//rpcCall calls a JSON-RPC method, decoding its result into result
+func rpcCall(ctx context.Context, client *http.Client, rpcURL string, method string, params []interface{}, result interface{}) (err error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req := struct {
+		JSONRPC string        `json:"jsonrpc"`
+		ID      int           `json:"id"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+	}{
+		"2.0",
+		1,
+		method,
+		params,
+	}
+	var data bytes.Buffer
+	if err = json.NewEncoder(&data).Encode(&req); err != nil {
+		return
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", rpcURL, &data)
+	if err != nil {
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = errors.New("JSON-RPC HTTP " + strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode))
+		return
+	}
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return
+	}
+	if rpcResp.Error != nil {
+		err = errors.New("JSON-RPC error " + strconv.Itoa(rpcResp.Error.Code) + ", Message: " + rpcResp.Error.Message)
+		return
+	}
+	err = json.Unmarshal(rpcResp.Result, result)
+	return
+}
+
+//Event is a Solidity event definition, used to decode logs
+type Event struct {
+	Name   string
+	Inputs []EventInput
+}
+
+type EventInput struct {
+	Name    string
+	Type    string
+	Indexed bool
+}
+
+//ParseEvent parses a Solidity-style event declaration, like
+//
+//	"MoveProposed(address indexed player, uint8 x, uint8 y, uint stake)"
+//
+//Only static types (address, bool, uintN, intN, bytesN) are supported.
+func ParseEvent(decl string) (event Event, err error) {
+	open, close := strings.Index(decl, "("), strings.LastIndex(decl, ")")
+	if open <= 0 || close < open {
+		err = errors.New("bcyeth: bad event declaration " + decl)
+		return
+	}
+	event.Name = strings.TrimSpace(decl[:open])
+	args := strings.TrimSpace(decl[open+1 : close])
+	if args == "" {
+		return
+	}
+	for _, arg := range strings.Split(args, ",") {
+		fields := strings.Fields(arg)
+		var in EventInput
+		switch {
+		case len(fields) == 3 && fields[1] == "indexed":
+			in = EventInput{fields[2], fields[0], true}
+		case len(fields) == 2:
+			in = EventInput{fields[1], fields[0], false}
+		default:
+			err = errors.New("bcyeth: bad event argument " + arg)
+			return
+		}
+		//canonical type names, as used in the signature
+		if in.Type == "uint" || in.Type == "int" {
+			in.Type += "256"
+		}
+		if !staticType(in.Type) {
+			err = errors.New("bcyeth: unsupported event argument type " + in.Type)
+			return
+		}
+		event.Inputs = append(event.Inputs, in)
+	}
+	return
+}
+
+func staticType(t string) bool {
+	return t == "address" || t == "bool" || strings.HasPrefix(t, "uint") ||
+		strings.HasPrefix(t, "int") || (strings.HasPrefix(t, "bytes") && t != "bytes")
+}
+
+//Signature is the canonical event signature, like "DrawProposed(address)"
+func (e Event) Signature() string {
+	types := make([]string, len(e.Inputs))
+	for i, in := range e.Inputs {
+		types[i] = in.Type
+	}
+	return e.Name + "(" + strings.Join(types, ",") + ")"
+}
+
+//Topic is the first topic of the event's logs, sha3 of its signature
+func (e Event) Topic() string {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(e.Signature()))
+	return "0x" + hex.EncodeToString(h.Sum(nil))
+}
+
+//Decode decodes a log's arguments by name; addresses and bytesN come
+//back as hex strings, bools as bool, and integers as *big.Int
+func (e Event) Decode(l Log) (args map[string]interface{}, err error) {
+	if len(l.Topics) == 0 || !strings.EqualFold(l.Topics[0], e.Topic()) {
+		err = errors.New("bcyeth: log is not a " + e.Name + " event")
+		return
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(l.Data, "0x"))
+	if err != nil {
+		return
+	}
+	args = make(map[string]interface{})
+	topic, word := 1, 0
+	for _, in := range e.Inputs {
+		var raw []byte
+		if in.Indexed {
+			if topic >= len(l.Topics) {
+				err = errors.New("bcyeth: " + e.Name + " log is missing topics")
+				return
+			}
+			raw, err = hex.DecodeString(strings.TrimPrefix(l.Topics[topic], "0x"))
+			if err != nil {
+				return
+			}
+			topic++
+		} else {
+			if (word+1)*32 > len(data) {
+				err = errors.New("bcyeth: " + e.Name + " log data is too short")
+				return
+			}
+			raw = data[word*32 : (word+1)*32]
+			word++
+		}
+		if len(raw) != 32 {
+			err = errors.New("bcyeth: " + e.Name + " log has a bad 32 byte word")
+			return
+		}
+		args[in.Name] = decodeWord(in.Type, raw)
+	}
+	return
+}
+
+//decodeWord decodes one 32 byte ABI word of a static type
+func decodeWord(t string, raw []byte) interface{} {
+	switch {
+	case t == "address":
+		return hex.EncodeToString(raw[12:])
+	case t == "bool":
+		return raw[31] != 0
+	case strings.HasPrefix(t, "uint"):
+		return new(big.Int).SetBytes(raw)
+	case strings.HasPrefix(t, "int"):
+		num := new(big.Int).SetBytes(raw)
+		if raw[0]&0x80 != 0 {
+			num.Sub(num, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return num
+	default:
+		//bytesN is left aligned
+		n, _ := strconv.Atoi(strings.TrimPrefix(t, "bytes"))
+		return hex.EncodeToString(raw[:n])
+	}
+}
@@ -0,0 +1,246 @@
+package bcyeth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//RetryPolicy retries requests that were rate limited, failed with a 5xx,
+//or never got a response, waiting an exponential backoff with jitter
+//between tries, or as long as BlockCypher's Retry-After asks if that's
+//longer. Only requests that are safe to repeat are retried: GET, PUT and
+//DELETE, and POSTs marked as reads with ReadOnly (like calls to constant
+//contract methods), never ones that might send a transaction twice.
+type RetryPolicy struct {
+	//MaxRetries is how many times a request is retried after the first try
+	MaxRetries int
+	//MinBackoff is the wait before the first retry, doubled for each after
+	MinBackoff time.Duration
+	//MaxBackoff caps the wait between tries, not counting Retry-After
+	MaxBackoff time.Duration
+}
+
+//DefaultRetry is a RetryPolicy for interactive use, giving up after a few seconds
+var DefaultRetry = &RetryPolicy{MaxRetries: 3, MinBackoff: 250 * time.Millisecond, MaxBackoff: 4 * time.Second}
+
+//backoff is the wait before retry n (from 0), with full jitter in its upper half
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.MinBackoff) * math.Pow(2, float64(n))
+	if max := float64(p.MaxBackoff); p.MaxBackoff > 0 && d > max {
+		d = max
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+type readOnlyKey struct{}
+
+//ReadOnly marks requests made with the returned context as reads,
+//so a RetryPolicy retries them even if they're POSTs
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+func isReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+type backgroundKey struct{}
+
+//Background marks requests made with the returned context as low priority,
+//like polling for confirmations: Limiters hold back BackgroundReserve of
+//their tokens from them, for requests someone's waiting on
+func Background(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+//BackgroundReserve is the share of a Limiter's burst that Background
+//requests leave for the rest
+var BackgroundReserve = 0.5
+
+//Limiter is a token bucket, letting through requests at an average
+//rate with bursts up to its size; requests past that wait their turn.
+//BlockCypher's limits depend on the token's plan, like 3 requests a
+//second and 200 an hour on the free one, each a Limiter:
+//
+//	api.Limiters = []*bcyeth.Limiter{
+//		bcyeth.NewLimiter(3, time.Second, 3),
+//		bcyeth.NewLimiter(200, time.Hour, 200),
+//	}
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 //tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+//NewLimiter allows n requests every per, in bursts of up to burst
+func NewLimiter(n int, per time.Duration, burst int) *Limiter {
+	return &Limiter{
+		rate:   float64(n) / per.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+//ParseLimits parses limits like "3/s,200/h" (requests per second,
+//minute or hour) into Limiters, each with bursts of its full count
+func ParseLimits(limits string) (limiters []*Limiter, err error) {
+	units := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	for _, limit := range strings.Split(limits, ",") {
+		limit = strings.TrimSpace(limit)
+		if limit == "" {
+			continue
+		}
+		parts := strings.Split(limit, "/")
+		var n int
+		if len(parts) == 2 {
+			n, err = strconv.Atoi(parts[0])
+		}
+		per, ok := units[parts[len(parts)-1]]
+		if len(parts) != 2 || err != nil || !ok || n <= 0 {
+			err = errors.New("bcyeth: bad limit " + limit + ", want like 3/s")
+			return
+		}
+		limiters = append(limiters, NewLimiter(n, per, n))
+	}
+	return
+}
+
+//Wait takes a token, waiting for one if the bucket's empty; it gives
+//up early if ctx is done, or would be before a token comes in, in which
+//case the error is a 429 APIError with how long until the token comes in,
+//as if BlockCypher had rate limited the request itself
+func (l *Limiter) Wait(ctx context.Context) (err error) {
+	if isBackground(ctx) {
+		return l.waitBackground(ctx)
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	//take the token now, so waiters line up behind each other
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		l.giveBack()
+		err = &APIError{
+			StatusCode: http.StatusTooManyRequests,
+			Errors:     []string{fmt.Sprintf("bcyeth: over the client-side rate limit for another %v", wait.Round(time.Second))},
+			RetryAfter: wait,
+		}
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.giveBack()
+		err = ctx.Err()
+	case <-timer.C:
+	}
+	return
+}
+
+//waitBackground takes a token only while more than BackgroundReserve of
+//the burst is left, rechecking as tokens come in; it doesn't line up,
+//so requests that aren't in the background always go first
+func (l *Limiter) waitBackground(ctx context.Context) (err error) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		need := 1 + l.burst*BackgroundReserve
+		if l.tokens >= need {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		wait := time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *Limiter) giveBack() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+//do sends a request through the API's client once the limiters
+//let it, retrying it as the API's RetryPolicy allows
+func (api *API) do(ctx context.Context, method string, target *url.URL, body []byte) (resp *http.Response, err error) {
+	retryable := api.Retry != nil && (method != "POST" || isReadOnly(ctx))
+	for try := 0; ; try++ {
+		for _, l := range api.Limiters {
+			if err = l.Wait(ctx); err != nil {
+				return
+			}
+		}
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err = api.client().Do(req)
+		if !retryable || try >= api.Retry.MaxRetries || ctx.Err() != nil {
+			return
+		}
+		wait := api.Retry.backoff(try)
+		if err == nil {
+			if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+				return
+			}
+			//Retry-After comes with the error response, which isn't needed anymore
+			apiErr := respErrorMaker(resp).(*APIError)
+			resp.Body.Close()
+			if apiErr.RetryAfter > wait {
+				wait = apiErr.RetryAfter
+			}
+			err = apiErr
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
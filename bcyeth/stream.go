@@ -0,0 +1,364 @@
+package bcyeth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//BlockCypher drops event stream connections that go quiet,
+//so a Stream pings it every pingPeriod, and reconnects if
+//nothing (not even a pong) comes back for pongWait
+const (
+	pingPeriod = 20 * time.Second
+	pongWait   = 60 * time.Second
+)
+
+//reconnects back off from a second up to a minute
+var reconnectBackoff = &RetryPolicy{MinBackoff: time.Second, MaxBackoff: time.Minute}
+
+//Subscription is an event filter for a Stream, with the same events
+//as a Hook (NewBlock, UnconfirmedTX, ConfirmedTX, TXConfirmation,
+//DoubleSpendTX), for transactions of Address or with Hash if either is set
+type Subscription struct {
+	Event         string `json:"event"`
+	Address       string `json:"address,omitempty"`
+	Hash          string `json:"hash,omitempty"`
+	Confirmations int    `json:"confirmations,omitempty"`
+	Token         string `json:"token,omitempty"`
+}
+
+//Block is a new block, from a NewBlock Subscription
+type Block struct {
+	Hash      string    `json:"hash"`
+	Height    int       `json:"height"`
+	Chain     string    `json:"chain"`
+	PrevBlock string    `json:"prev_block"`
+	Time      time.Time `json:"time"`
+	NTx       int       `json:"n_tx"`
+}
+
+//StreamEvent is what a Subscription matched: Block is set for
+//NewBlock, and TX for every other event
+type StreamEvent struct {
+	Sub   Subscription
+	Block *Block
+	TX    *TX
+}
+
+//matches reports whether an event is for a subscription; BlockCypher
+//doesn't say which filter a message is for, so it's worked out from
+//the message itself
+func (sub Subscription) matches(block *Block, tx *TX) bool {
+	if sub.Event == NewBlock {
+		return block != nil
+	}
+	if tx == nil {
+		return false
+	}
+	if sub.Hash != "" && strings.TrimPrefix(sub.Hash, "0x") != tx.Hash {
+		return false
+	}
+	if sub.Address != "" {
+		addr := strings.ToLower(strings.TrimPrefix(sub.Address, "0x"))
+		found := false
+		for _, a := range tx.Addresses {
+			found = found || a == addr
+		}
+		if !found {
+			return false
+		}
+	}
+	switch sub.Event {
+	case UnconfirmedTX:
+		return tx.BlockHeight <= 0
+	case ConfirmedTX, TXConfirmation:
+		return tx.BlockHeight > 0
+	case DoubleSpendTX:
+		return tx.DoubleSpend
+	}
+	return false
+}
+
+//Stream follows BlockCypher's WebSocket event stream, reconnecting
+//(and resubscribing) whenever the connection drops, until the
+//context it was made with is done. Make one with NewStream
+type Stream struct {
+	api  *API
+	done chan struct{}
+	mu   sync.Mutex
+	conn *websocket.Conn
+	subs []*streamSub
+	err  error
+	//called after every connection but the first, see OnReconnect
+	onReconnect []func()
+	reconnected bool
+	//false from the time the connection drops until the reconnect callbacks are done
+	ready bool
+}
+
+type streamSub struct {
+	sub Subscription
+	ctx context.Context
+	in  chan StreamEvent
+}
+
+//NewStream connects to the event stream, in the background
+func (api *API) NewStream(ctx context.Context) (s *Stream) {
+	copied := *api
+	s = &Stream{api: &copied, done: make(chan struct{})}
+	go s.run(ctx)
+	return
+}
+
+//Subscribe sends events matching sub on the returned channel, until ctx
+//is done or the Stream is, when the channel is closed. Events wait for
+//the channel to be read, holding up the rest of the Stream, so read it
+//promptly. If sub has no Token, it gets the API's
+func (s *Stream) Subscribe(ctx context.Context, sub Subscription) <-chan StreamEvent {
+	if sub.Token == "" {
+		sub.Token = s.api.Token
+	}
+	ss := &streamSub{sub: sub, ctx: ctx, in: make(chan StreamEvent, 16)}
+	out := make(chan StreamEvent)
+	s.mu.Lock()
+	s.subs = append(s.subs, ss)
+	if s.conn != nil {
+		//if this fails, the connection's broken and run resubscribes
+		s.conn.WriteJSON(&ss.sub)
+	}
+	s.mu.Unlock()
+	go func() {
+		defer close(out)
+		defer s.unsubscribe(ss)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			case ev := <-ss.in:
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				case <-s.done:
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (s *Stream) unsubscribe(ss *streamSub) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.subs {
+		if other == ss {
+			s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+//Err is why the Stream last lost its connection, or nil while it's connected
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+//Connected reports whether the Stream is connected and subscribed right now;
+//events that happen while it isn't are never delivered
+func (s *Stream) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil && s.ready
+}
+
+//OnReconnect calls f every time the Stream reconnects, once it's
+//resubscribed, so anything kept up to date by its events can be
+//refreshed; events from while it was disconnected are lost
+func (s *Stream) OnReconnect(f func()) {
+	s.mu.Lock()
+	s.onReconnect = append(s.onReconnect, f)
+	s.mu.Unlock()
+}
+
+//run keeps the Stream connected until ctx is done
+func (s *Stream) run(ctx context.Context) {
+	defer close(s.done)
+	for try := 0; ; try++ {
+		connected, err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		if connected {
+			try = 0
+		}
+		timer := time.NewTimer(reconnectBackoff.backoff(try))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+//connect dials the event stream, sends it every subscription, and
+//delivers its events until the connection drops
+func (s *Stream) connect(ctx context.Context) (connected bool, err error) {
+	u, err := s.socketURL()
+	if err != nil {
+		return
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	s.mu.Lock()
+	for _, ss := range s.subs {
+		if err = conn.WriteJSON(&ss.sub); err != nil {
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.conn, s.err = conn, nil
+	reconnected := s.reconnected
+	s.reconnected = true
+	callbacks := append([]func(){}, s.onReconnect...)
+	s.mu.Unlock()
+	connected = true
+	//the Stream isn't Connected until the callbacks are done, so
+	//nothing it keeps fresh is trusted before they've refreshed it
+	if reconnected {
+		for _, f := range callbacks {
+			f()
+		}
+	}
+	s.mu.Lock()
+	s.ready = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conn, s.ready = nil, false
+		s.mu.Unlock()
+	}()
+	//closing the connection stops the read below
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(ctx, conn, stop)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		var msg []byte
+		_, msg, err = conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		s.dispatch(msg)
+	}
+}
+
+//ping keeps the connection alive the way BlockCypher asks, with
+//a ping event, and closes it once ctx is done
+func (s *Stream) ping(ctx context.Context, conn *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			conn.Close()
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			err := conn.WriteJSON(&Subscription{Event: "ping"})
+			s.mu.Unlock()
+			if err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+//dispatch decodes a message, and sends it to the subscriptions it matches
+func (s *Stream) dispatch(msg []byte) {
+	var probe struct {
+		Event  string `json:"event"`
+		Height *int   `json:"height"`
+	}
+	if json.Unmarshal(msg, &probe) != nil || probe.Event == "pong" {
+		return
+	}
+	var block *Block
+	var tx *TX
+	if probe.Height != nil {
+		block = new(Block)
+		if json.Unmarshal(msg, block) != nil {
+			return
+		}
+	} else {
+		tx = new(TX)
+		if json.Unmarshal(msg, tx) != nil {
+			return
+		}
+	}
+	s.mu.Lock()
+	subs := append([]*streamSub(nil), s.subs...)
+	s.mu.Unlock()
+	for _, ss := range subs {
+		if !ss.sub.matches(block, tx) {
+			continue
+		}
+		select {
+		case ss.in <- StreamEvent{Sub: ss.sub, Block: block, TX: tx}:
+		case <-ss.ctx.Done():
+		}
+	}
+}
+
+//socketURL is the event stream's URL for the API's coin/chain
+func (s *Stream) socketURL() (target *url.URL, err error) {
+	base, coin, chain := s.api.SocketURL, s.api.Coin, s.api.Chain
+	if base == "" {
+		base = DefaultSocketURL
+	}
+	if coin == "" {
+		coin = "eth"
+	}
+	if chain == "" {
+		chain = "main"
+	}
+	target, err = url.Parse(base + "/" + coin + "/" + chain)
+	if err != nil {
+		return
+	}
+	if target.Scheme != "ws" && target.Scheme != "wss" {
+		err = errors.New("bcyeth: event stream URL must be ws or wss, not " + target.Scheme)
+		return
+	}
+	if s.api.Token != "" {
+		values := target.Query()
+		values.Set("token", s.api.Token)
+		target.RawQuery = values.Encode()
+	}
+	return
+}
@@ -0,0 +1,274 @@
+package bcyeth
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+type TX struct {
+	BlockHeight   int        `json:"block_height,omitempty"`
+	BlockHash     string     `json:"block_hash,omitempty"`
+	Hash          string     `json:"hash,omitempty"`
+	Addresses     []string   `json:"addresses,omitempty"`
+	Total         big.Int    `json:"total,omitempty"`
+	Fees          big.Int    `json:"fees,omitempty"`
+	GasLimit      int        `json:"gas_limit,omitempty"`
+	GasUsed       int        `json:"gas_used,omitempty"`
+	GasPrice      int        `json:"gas_price,omitempty"`
+	Received      time.Time  `json:"received,omitempty"`
+	Confirmed     time.Time  `json:"confirmed,omitempty"`
+	Confirmations int        `json:"confirmations,omitempty"`
+	DoubleSpend   bool       `json:"double_spend,omitempty"`
+	Inputs        []TXInput  `json:"inputs"`
+	Outputs       []TXOutput `json:"outputs"`
+}
+
+type TXInput struct {
+	Addresses []string `json:"addresses"`
+}
+
+type TXOutput struct {
+	Addresses []string `json:"addresses"`
+	Value     big.Int  `json:"value"`
+}
+
+type TXSkeleton struct {
+	Trans      TX       `json:"tx"`
+	ToSign     []string `json:"tosign"`
+	Signatures []string `json:"signatures"`
+	Errors     []struct {
+		Error string `json:"error,omitempty"`
+	} `json:"errors,omitempty"`
+}
+
+//GetTX returns a transaction by its hash; Confirmations
+//is 0 until it's mined, and BlockHeight -1
+func (api *API) GetTX(hash string) (trans TX, err error) {
+	return api.GetTXContext(context.Background(), hash)
+}
+
+//GetTXContext is GetTX, but gives up when ctx is done
+func (api *API) GetTXContext(ctx context.Context, hash string) (trans TX, err error) {
+	u, err := api.buildURL("/txs/"+hash, nil)
+	if err != nil {
+		return
+	}
+	err = api.getResponse(ctx, u, &trans)
+	return
+}
+
+//PollInterval is how long WaitForConfirmations waits before checking on
+//a transaction again, Ethereum mines a block about every 15 seconds; the
+//wait grows by half after each check, up to MaxPollInterval
+var PollInterval = 15 * time.Second
+var MaxPollInterval = 2 * time.Minute
+
+//WaitForConfirmations polls a transaction until it has at least n
+//confirmations, then returns it. A freshly sent transaction can take
+//a moment to show up, so until then not found isn't an error. Polls
+//are Background requests, see Limiter
+func (api *API) WaitForConfirmations(hash string, n int) (trans TX, err error) {
+	return api.WaitForConfirmationsContext(context.Background(), hash, n)
+}
+
+//WaitForConfirmationsContext is WaitForConfirmations, but gives up when ctx is done
+func (api *API) WaitForConfirmationsContext(ctx context.Context, hash string, n int) (trans TX, err error) {
+	interval := PollInterval
+	for {
+		trans, err = api.GetTXContext(Background(ctx), hash)
+		if err == nil && trans.Confirmations >= n {
+			return
+		}
+		if err != nil && !IsNotFound(err) {
+			return
+		}
+		timer := time.NewTimer(interval)
+		if interval += interval / 2; interval > MaxPollInterval {
+			interval = MaxPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+//NewTX asks BlockCypher to build a transaction skeleton, with
+//the data that needs to be signed in ToSign
+func (api *API) NewTX(trans TX) (skel TXSkeleton, err error) {
+	return api.NewTXContext(context.Background(), trans)
+}
+
+//NewTXContext is NewTX, but gives up when ctx is done
+func (api *API) NewTXContext(ctx context.Context, trans TX) (skel TXSkeleton, err error) {
+	u, err := api.buildURL("/txs/new", nil)
+	if err != nil {
+		return
+	}
+	err = api.postResponse(ctx, u, &trans, &skel)
+	return
+}
+
+//SendTX sends a signed transaction skeleton to BlockCypher,
+//returning the completed skeleton
+func (api *API) SendTX(skel TXSkeleton) (trans TXSkeleton, err error) {
+	return api.SendTXContext(context.Background(), skel)
+}
+
+//SendTXContext is SendTX, but gives up when ctx is done
+func (api *API) SendTXContext(ctx context.Context, skel TXSkeleton) (trans TXSkeleton, err error) {
+	u, err := api.buildURL("/txs/send", nil)
+	if err != nil {
+		return
+	}
+	err = api.postResponse(ctx, u, &skel, &trans)
+	return
+}
+
+//PushTX broadcasts a transaction signed elsewhere, given as
+//hex-encoded raw RLP, returning it as BlockCypher decoded it
+func (api *API) PushTX(raw string) (trans TX, err error) {
+	return api.PushTXContext(context.Background(), raw)
+}
+
+//PushTXContext is PushTX, but gives up when ctx is done
+func (api *API) PushTXContext(ctx context.Context, raw string) (trans TX, err error) {
+	u, err := api.buildURL("/txs/push", nil)
+	if err != nil {
+		return
+	}
+	err = api.postResponse(ctx, u, &rawTX{raw}, &trans)
+	return
+}
+
+//DecodeTX decodes a hex-encoded raw transaction without broadcasting it,
+//to check what it does before a PushTX
+func (api *API) DecodeTX(raw string) (trans TX, err error) {
+	return api.DecodeTXContext(context.Background(), raw)
+}
+
+//DecodeTXContext is DecodeTX, but gives up when ctx is done
+func (api *API) DecodeTXContext(ctx context.Context, raw string) (trans TX, err error) {
+	u, err := api.buildURL("/txs/decode", nil)
+	if err != nil {
+		return
+	}
+	//decoding doesn't change anything, so it's safe to retry
+	err = api.postResponse(ReadOnly(ctx), u, &rawTX{raw}, &trans)
+	return
+}
+
+type rawTX struct {
+	TX string `json:"tx"`
+}
+
+//Sign signs every ToSign entry of the skeleton with the hex-encoded
+//private key, filling in Signatures
+func (skel *TXSkeleton) Sign(private string) (err error) {
+	raw, err := hex.DecodeString(private)
+	if err != nil {
+		return
+	}
+	priv, _ := btcec.PrivKeyFromBytes(raw)
+	skel.Signatures = nil
+	for _, v := range skel.ToSign {
+		var tosign []byte
+		tosign, err = hex.DecodeString(v)
+		if err != nil {
+			return
+		}
+		skel.Signatures = append(skel.Signatures, hex.EncodeToString(ecdsa.Sign(priv, tosign).Serialize()))
+	}
+	return
+}
+
+//PrivToAddr returns the (hex, no 0x) ethereum address
+//belonging to a hex-encoded private key
+func PrivToAddr(private string) (addr string, err error) {
+	raw, err := hex.DecodeString(private)
+	if err != nil {
+		return
+	}
+	_, pub := btcec.PrivKeyFromBytes(raw)
+	h := sha3.NewLegacyKeccak256()
+	h.Write(pub.SerializeUncompressed()[1:])
+	addr = hex.EncodeToString(h.Sum(nil)[12:])
+	return
+}
+
+//SignHash signs a 32 byte hash with the hex-encoded private key, returning
+//the 65 byte signature r, s, v as hex, with v 27 or 28 like ecrecover expects
+func SignHash(private string, hash []byte) (sig string, err error) {
+	raw, err := hex.DecodeString(private)
+	if err != nil {
+		return
+	}
+	priv, _ := btcec.PrivKeyFromBytes(raw)
+	compact := ecdsa.SignCompact(priv, hash, false)
+	//compact is v, r, s
+	sig = hex.EncodeToString(append(compact[1:], compact[0]))
+	return
+}
+
+//RecoverAddr returns the address that made a SignHash signature of hash
+func RecoverAddr(hash []byte, sig string) (addr string, err error) {
+	raw, err := hex.DecodeString(sig)
+	if err != nil {
+		return
+	}
+	if len(raw) != 65 {
+		err = errors.New("bcyeth: signature must be 65 bytes")
+		return
+	}
+	pub, _, err := ecdsa.RecoverCompact(append([]byte{raw[64]}, raw[:64]...), hash)
+	if err != nil {
+		return
+	}
+	h := sha3.NewLegacyKeccak256()
+	h.Write(pub.SerializeUncompressed()[1:])
+	addr = hex.EncodeToString(h.Sum(nil)[12:])
+	return
+}
+
+//SendValue transfers value in wei from the address of the private key
+//to another address (or a contract's fallback function), returning
+//the transaction hash
+func (api *API) SendValue(private string, to string, value big.Int, gasLimit int) (hash string, err error) {
+	return api.SendValueContext(context.Background(), private, to, value, gasLimit)
+}
+
+//SendValueContext is SendValue, but gives up when ctx is done
+func (api *API) SendValueContext(ctx context.Context, private string, to string, value big.Int, gasLimit int) (hash string, err error) {
+	from, err := PrivToAddr(private)
+	if err != nil {
+		return
+	}
+	trans := TX{
+		Inputs:   []TXInput{TXInput{Addresses: []string{from}}},
+		Outputs:  []TXOutput{TXOutput{Addresses: []string{to}, Value: value}},
+		GasLimit: gasLimit,
+	}
+	skel, err := api.NewTXContext(ctx, trans)
+	if err != nil {
+		return
+	}
+	if err = skel.Sign(private); err != nil {
+		return
+	}
+	skel, err = api.SendTXContext(ctx, skel)
+	if err != nil {
+		return
+	}
+	hash = skel.Trans.Hash
+	return
+}
@@ -0,0 +1,938 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+
+	"github.com/acityinohio/baduk"
+	"golang.org/x/crypto/sha3"
+)
+
+//ChannelMove is one move of a game played in state channel mode
+type ChannelMove struct {
+	X     int
+	Y     int
+	Color int
+}
+
+//ChannelState is a game state both players sign off-chain,
+//see channelHash in ethduck.sol; sigs are r, s, v hex
+type ChannelState struct {
+	Nonce    int
+	Moves    string
+	Result   int
+	BlackSig string
+	WhiteSig string
+}
+
+//ChannelProposal is a state only its proposer signed so far,
+//along with the move it adds, if any
+type ChannelProposal struct {
+	Move  *ChannelMove
+	State ChannelState
+}
+
+//ChannelAnswer is a move sent to the contract with answerDispute, and the
+//state it makes latest once its transaction is mined
+type ChannelAnswer struct {
+	Move  ChannelMove
+	State ChannelState
+	Hash  string
+	Sent  time.Time
+}
+
+//Channel is the move chain of a game in state channel mode: players exchange
+//signed states through the server, and only go on-chain to settle or dispute.
+//It's an offer until both players signed the opening state (nonce 0) and the
+//contract recorded it with openChannel
+type Channel struct {
+	ContractAddr string
+	Black        string
+	White        string
+	Moves        []ChannelMove
+	Latest       ChannelState
+	Pending      *ChannelProposal
+	Answering    *ChannelAnswer
+}
+
+//channels are stored as JSON files in channelDir, since losing the
+//latest co-signed state means losing the ability to dispute with it
+const channelDir = "./channels"
+
+var channels struct {
+	sync.Mutex
+	byAddr map[string]*Channel
+}
+
+//loadChannel returns the game's channel, or nil if it isn't in state channel mode
+//callers hold channels' lock
+func loadChannel(contractAddr string) (c *Channel, err error) {
+	if channels.byAddr == nil {
+		channels.byAddr = make(map[string]*Channel)
+	}
+	if c = channels.byAddr[contractAddr]; c != nil {
+		return
+	}
+	file, err := os.Open(filepath.Join(channelDir, filepath.Base(contractAddr)+".json"))
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	c = new(Channel)
+	if err = json.NewDecoder(file).Decode(c); err != nil {
+		c = nil
+		return
+	}
+	channels.byAddr[contractAddr] = c
+	return
+}
+
+//saveChannel stores the channel; callers hold channels' lock
+func saveChannel(c *Channel) (err error) {
+	if err = os.MkdirAll(channelDir, 0700); err != nil {
+		return
+	}
+	path := filepath.Join(channelDir, filepath.Base(c.ContractAddr)+".json")
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return
+	}
+	err = json.NewEncoder(file).Encode(c)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return
+	}
+	if channels.byAddr == nil {
+		channels.byAddr = make(map[string]*Channel)
+	}
+	channels.byAddr[c.ContractAddr] = c
+	return
+}
+
+//moveHash extends the hash chain of moves, sha3(moves, x, y, color)
+func moveHash(moves string, m ChannelMove) (next string, err error) {
+	raw, err := hex.DecodeString(moves)
+	if err != nil {
+		return
+	}
+	h := sha3.NewLegacyKeccak256()
+	h.Write(raw)
+	h.Write([]byte{byte(m.X), byte(m.Y), byte(m.Color)})
+	next = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+//stateHash is what players sign, sha3(contract, nonce, moves, result) tightly packed
+func stateHash(contractAddr string, st ChannelState) (hash []byte, err error) {
+	addr, err := hex.DecodeString(strings.TrimPrefix(contractAddr, "0x"))
+	if err != nil {
+		return
+	}
+	moves, err := hex.DecodeString(st.Moves)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, 32)
+	big.NewInt(int64(st.Nonce)).FillBytes(nonce)
+	h := sha3.NewLegacyKeccak256()
+	h.Write(addr)
+	h.Write(nonce)
+	h.Write(moves)
+	h.Write([]byte{byte(st.Result)})
+	hash = h.Sum(nil)
+	return
+}
+
+//player returns the color (1 black, 2 white) of the private key's address
+func (c *Channel) player(private string) (color int, err error) {
+	addr, err := bcyeth.PrivToAddr(private)
+	if err != nil {
+		return
+	}
+	switch addr {
+	case c.Black:
+		color = 1
+	case c.White:
+		color = 2
+	default:
+		err = errors.New("Private key isn't one of this game's players")
+	}
+	return
+}
+
+//blackTurn is true when black proposes next, black moves on even move counts
+func (c *Channel) blackTurn() bool {
+	return len(c.Moves)%2 == 0
+}
+
+//board replays the channel's moves onto a new board
+func (c *Channel) board(size int) (state baduk.Board, err error) {
+	state.Init(size)
+	for _, m := range c.Moves {
+		if m.Color == 1 {
+			err = state.SetB(m.X, m.Y)
+		} else {
+			err = state.SetW(m.X, m.Y)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+//sign signs a state as the given color
+func (c *Channel) sign(private string, color int, st *ChannelState) (err error) {
+	hash, err := stateHash(c.ContractAddr, *st)
+	if err != nil {
+		return
+	}
+	sig, err := bcyeth.SignHash(private, hash)
+	if err != nil {
+		return
+	}
+	if color == 1 {
+		st.BlackSig = sig
+	} else {
+		st.WhiteSig = sig
+	}
+	return
+}
+
+//verify checks a state was signed by both players
+func (c *Channel) verify(st ChannelState) (err error) {
+	hash, err := stateHash(c.ContractAddr, st)
+	if err != nil {
+		return
+	}
+	black, err := bcyeth.RecoverAddr(hash, st.BlackSig)
+	if err != nil {
+		return
+	}
+	white, err := bcyeth.RecoverAddr(hash, st.WhiteSig)
+	if err != nil {
+		return
+	}
+	if black != c.Black || white != c.White {
+		err = errors.New("State isn't signed by both players")
+	}
+	return
+}
+
+//propose signs a new state as the player whose turn it is, adding move m
+//or, if m is nil, the result (1 black won, 2 white won, 3 draw)
+func (c *Channel) propose(private string, m *ChannelMove, result int, size int) (err error) {
+	if c.Pending != nil {
+		return errors.New("Opponent still needs to approve the last proposal")
+	}
+	if c.Latest.Result != 0 {
+		return errors.New("Game is over, submit it to the contract to settle")
+	}
+	color, err := c.player(private)
+	if err != nil {
+		return
+	}
+	if (color == 1) != c.blackTurn() {
+		return errors.New("Not your turn")
+	}
+	st := ChannelState{Nonce: c.Latest.Nonce + 1, Moves: c.Latest.Moves, Result: result}
+	if m != nil {
+		st.Moves, err = c.addMove(m, color, size)
+		if err != nil {
+			return
+		}
+	}
+	if err = c.sign(private, color, &st); err != nil {
+		return
+	}
+	c.Pending = &ChannelProposal{m, st}
+	return
+}
+
+//addMove checks the move is legal for color, and returns the move chain with it
+func (c *Channel) addMove(m *ChannelMove, color int, size int) (moves string, err error) {
+	m.Color = color
+	state, err := c.board(size)
+	if err != nil {
+		return
+	}
+	if color == 1 {
+		err = state.SetB(m.X, m.Y)
+	} else {
+		err = state.SetW(m.X, m.Y)
+	}
+	if err != nil {
+		return
+	}
+	moves, err = moveHash(c.Latest.Moves, *m)
+	return
+}
+
+//answer makes a move on-chain, in a disputed game: the contract extends its move chain
+//the same way, so the move becomes the latest state without anyone signing it,
+//once the transaction is mined (see answerMined)
+func (c *Channel) answer(ctx context.Context, private string, m *ChannelMove, size int) (err error) {
+	if c.Answering != nil {
+		return errors.New("The last dispute move is still waiting to be mined")
+	}
+	color, err := c.player(private)
+	if err != nil {
+		return
+	}
+	if (color == 1) != c.blackTurn() {
+		return errors.New("Not your turn")
+	}
+	moves, err := c.addMove(m, color, size)
+	if err != nil {
+		return
+	}
+	hash, err := answerDispute(ctx, c.ContractAddr, private, *m)
+	if err != nil {
+		return
+	}
+	c.Answering = &ChannelAnswer{*m, ChannelState{Nonce: c.Latest.Nonce + 1, Moves: moves}, hash, time.Now()}
+	go answerMined(c.ContractAddr, hash)
+	return
+}
+
+//answered makes a dispute move the latest state if the contract took it,
+//or drops it if its transaction was mined (or lost) without the contract taking it;
+//callers hold channels' lock
+func (c *Channel) answered(ctx context.Context, mined bool) (err error) {
+	if c.Answering == nil {
+		return
+	}
+	nonce, err := getChannelNonce(ctx, c.ContractAddr)
+	if err != nil {
+		return
+	}
+	if nonce >= c.Answering.State.Nonce {
+		c.Moves = append(c.Moves, c.Answering.Move)
+		c.Latest, c.Pending = c.Answering.State, nil
+	} else if !mined && time.Since(c.Answering.Sent) < pendingTimeout {
+		return
+	}
+	c.Answering = nil
+	err = saveChannel(c)
+	return
+}
+
+//answerMined waits for a dispute move's transaction, then applies it to the channel
+func answerMined(contractAddr string, hash string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pendingTimeout)
+	defer cancel()
+	_, waitErr := bcy.WaitForConfirmationsContext(ctx, hash, 1)
+	if waitErr != nil {
+		log.Printf("gave up waiting on dispute move %s for %s: %v", hash, contractAddr, waitErr)
+	}
+	channels.Lock()
+	defer channels.Unlock()
+	c, err := loadChannel(contractAddr)
+	if err != nil || c == nil || c.Answering == nil || c.Answering.Hash != hash {
+		return
+	}
+	//a fresh context, the wait may have used this one up
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err = c.answered(ctx, waitErr == nil); err != nil {
+		log.Printf("applying dispute move %s for %s: %v", hash, contractAddr, err)
+	}
+}
+
+//signed is true once both players signed the state
+func (st ChannelState) signed() bool {
+	return st.BlackSig != "" && st.WhiteSig != ""
+}
+
+//authorize co-signs the pending proposal as the opponent, or drops it
+func (c *Channel) authorize(private string, approve bool) (err error) {
+	if c.Pending == nil {
+		return errors.New("Nothing to approve")
+	}
+	color, err := c.player(private)
+	if err != nil {
+		return
+	}
+	if (color == 1) == c.blackTurn() {
+		return errors.New("You can't approve your own proposal")
+	}
+	if !approve {
+		c.Pending = nil
+		return
+	}
+	st := c.Pending.State
+	if err = c.sign(private, color, &st); err != nil {
+		return
+	}
+	if err = c.verify(st); err != nil {
+		return
+	}
+	if c.Pending.Move != nil {
+		c.Moves = append(c.Moves, *c.Pending.Move)
+	}
+	c.Latest, c.Pending = st, nil
+	return
+}
+
+//describe is a human readable description of the pending proposal
+func (p *ChannelProposal) describe() string {
+	color := "Black"
+	if p.State.Result == 2 || (p.Move != nil && p.Move.Color == 2) {
+		color = "White"
+	}
+	if p.Move != nil {
+		return color + " wants to move on " + strconv.Itoa(p.Move.X) + ", " + strconv.Itoa(p.Move.Y) + "."
+	}
+	if p.State.Result == 3 {
+		return "Your opponent proposed a draw."
+	}
+	return color + " stone proposed that they won!"
+}
+
+//channelGame replays a state channel game onto the game's board, returning
+//a copy of its channel (nil if the game isn't in state channel mode) and
+//the contract's dispute deadline block (0 if no one disputed); a channel
+//the contract hasn't recorded yet is returned as offer instead
+func channelGame(ctx context.Context, game *Game) (channel *Channel, offer *Channel, deadline int, err error) {
+	channels.Lock()
+	c, err := loadChannel(game.ContractAddr)
+	if c != nil {
+		copied := *c
+		channel = &copied
+	}
+	channels.Unlock()
+	if err != nil || channel == nil {
+		return
+	}
+	mode, err := getChannelMode(ctx, game.ContractAddr)
+	if err != nil {
+		return
+	}
+	if !mode {
+		channel, offer = nil, channel
+		return
+	}
+	size, err := getSize(ctx, game.ContractAddr)
+	if err != nil {
+		return
+	}
+	game.State, err = channel.board(size)
+	if err != nil {
+		return
+	}
+	game.BlackTurn = channel.blackTurn()
+	game.BlackScore, game.WhiteScore = game.State.Score()
+	deadline, err = getDisputeDeadline(ctx, game.ContractAddr)
+	return
+}
+
+//activeChannel loads the game's channel if the contract is in state channel
+//mode, nil otherwise; callers hold channels' lock
+func activeChannel(ctx context.Context, contractAddr string) (c *Channel, err error) {
+	c, err = loadChannel(contractAddr)
+	if err != nil || c == nil {
+		return
+	}
+	mode, err := getChannelMode(ctx, contractAddr)
+	if err != nil || !mode {
+		c = nil
+		return
+	}
+	//a dispute move sent before a restart has no one waiting on it
+	err = c.answered(ctx, false)
+	return
+}
+
+//channel handlers; each takes the channels lock for the whole request,
+//so states are signed one at a time
+
+//openChannelHandler signs the opening state for a player; the first to sign offers
+//state channel mode, and the second accepts, recording it on the contract
+func openChannelHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/channel/open/"):]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		channels.Lock()
+		defer channels.Unlock()
+		c, err := loadChannel(contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if c != nil && c.Latest.signed() {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		game, err := loadGame(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if !game.Confirmed || game.Nigiri || game.ApprovalLock || game.NumMoves > 0 {
+			http.Error(w, "Only confirmed games with no moves yet can switch to state channel mode", http.StatusBadRequest)
+			return
+		}
+		if c == nil {
+			c = &Channel{
+				ContractAddr: contractAddr,
+				Latest:       ChannelState{Moves: hex.EncodeToString(make([]byte, 32))},
+			}
+			c.Black, err = getBlack(r.Context(), contractAddr)
+			if err != nil {
+				serveError(w, err)
+				return
+			}
+			c.White, err = getWhite(r.Context(), contractAddr)
+			if err != nil {
+				serveError(w, err)
+				return
+			}
+		}
+		color, err := c.player(private)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		//the loaded channel is only changed once the contract took it
+		st := c.Latest
+		if err = c.sign(private, color, &st); err != nil {
+			serveError(w, err)
+			return
+		}
+		if st.signed() {
+			if err = c.verify(st); err != nil {
+				serveError(w, err)
+				return
+			}
+			if err = openChannel(r.Context(), contractAddr, private, st); err != nil {
+				serveError(w, err)
+				return
+			}
+		}
+		c.Latest = st
+		if err = saveChannel(c); err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	} else {
+		message := "Offer to play off-chain! Moves are signed through the server, and only go to the contract to settle or dispute. Once your opponent signs too, the contract only takes off-chain states. Enter your private key to sign."
+		channels.Lock()
+		c, err := loadChannel(contractAddr)
+		channels.Unlock()
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if c != nil {
+			message = "One player offered to play off-chain: moves are signed through the server, and only go to the contract to settle or dispute. The other player enters their private key here to sign too, and switch the contract to state channel mode."
+		}
+		data := struct {
+			Message string
+			Post    string
+		}{
+			message,
+			"/channel/open/" + contractAddr,
+		}
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//channelMoveHandler proposes a move from the game page's move modal
+func channelMoveHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/channel/move/"):]
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	}
+	f := r.FormValue
+	rawmove := strings.Split(f("orig-message"), "-")
+	private := f("private")
+	if len(rawmove) != 3 {
+		http.Error(w, "Bad move", http.StatusBadRequest)
+		return
+	}
+	x, _ := strconv.Atoi(rawmove[1])
+	y, _ := strconv.Atoi(rawmove[2])
+	size, err := getSize(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	channels.Lock()
+	defer channels.Unlock()
+	c, err := activeChannel(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if c == nil {
+		http.Error(w, "Game isn't in state channel mode", http.StatusNotFound)
+		return
+	}
+	deadline, err := getDisputeDeadline(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	//once disputed, moves go on-chain
+	if deadline != 0 {
+		err = c.answer(r.Context(), private, &ChannelMove{X: x, Y: y}, size)
+	} else {
+		err = c.propose(private, &ChannelMove{X: x, Y: y}, 0, size)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = saveChannel(c); err != nil {
+		serveError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+}
+
+//channelProposeHandler proposes a result, /channel/propose/win/ or /channel/propose/draw/
+func channelProposeHandler(w http.ResponseWriter, r *http.Request) {
+	rest := r.URL.Path[len("/channel/propose/"):]
+	i := strings.Index(rest, "/")
+	if i < 0 || (rest[:i] != "win" && rest[:i] != "draw") {
+		http.NotFound(w, r)
+		return
+	}
+	kind, contractAddr := rest[:i], rest[i+1:]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		channels.Lock()
+		defer channels.Unlock()
+		c, err := activeChannel(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if c == nil {
+			http.Error(w, "Game isn't in state channel mode", http.StatusNotFound)
+			return
+		}
+		result := 3
+		if kind == "win" {
+			result, err = c.player(private)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err = c.propose(private, nil, result, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = saveChannel(c); err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	} else {
+		message := "Propose a draw! Make sure it's your turn, then enter your private key here."
+		if kind == "win" {
+			message = "Propose yourself winner! Make sure it's your turn, then enter your private key here."
+		}
+		data := struct {
+			Message string
+			Post    string
+		}{
+			message,
+			"/channel/propose/" + kind + "/" + contractAddr,
+		}
+		err := templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//channelAuthHandler co-signs (or rejects) the pending proposal
+func channelAuthHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/channel/auth/"):]
+	channels.Lock()
+	defer channels.Unlock()
+	c, err := activeChannel(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if c == nil {
+		http.Error(w, "Game isn't in state channel mode", http.StatusNotFound)
+		return
+	}
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if err = c.authorize(private, approve); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = saveChannel(c); err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	} else {
+		if c.Pending == nil {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		data := struct {
+			Message string
+			Post    string
+		}{
+			c.Pending.describe(),
+			"/channel/auth/" + contractAddr,
+		}
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//channelSubmitHandler submits the latest co-signed state to the contract:
+//a finished game settles, an unfinished one starts a dispute
+func channelSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/channel/submit/"):]
+	channels.Lock()
+	defer channels.Unlock()
+	c, err := activeChannel(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if c == nil {
+		http.Error(w, "Game isn't in state channel mode", http.StatusNotFound)
+		return
+	}
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		//states after a dispute's on-chain moves are already on the contract
+		if !c.Latest.signed() {
+			http.Error(w, "The latest state is already on the contract", http.StatusBadRequest)
+			return
+		}
+		if err = c.verify(c.Latest); err != nil {
+			serveError(w, err)
+			return
+		}
+		if err = submitState(r.Context(), contractAddr, private, c.Latest); err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	} else {
+		var message string
+		if c.Latest.Result != 0 {
+			message = "Both players signed the result, submit it to the contract to pay out the pot."
+		} else {
+			message = "Dispute the game by submitting the latest state both players signed. Play then goes on-chain: whoever's turn it is has to move before the deadline, or submit a newer state, or they forfeit."
+		}
+		data := struct {
+			Message string
+			Post    string
+		}{
+			message,
+			"/channel/submit/" + contractAddr,
+		}
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//channelFinalizeHandler ends a dispute once its deadline passed
+func channelFinalizeHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/channel/finalize/"):]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		err := finalizeDispute(r.Context(), contractAddr, private)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	} else {
+		data := struct {
+			Message string
+			Post    string
+		}{
+			"If the dispute deadline passed with no newer state or move, the player whose turn it was forfeits, and the other wins.",
+			"/channel/finalize/" + contractAddr,
+		}
+		err := templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//channel contract helpers
+
+//splitSigs splits a state's [black, white] signatures into their v, r and s parts
+func splitSigs(st ChannelState) (v []int, rs []string, ss []string, err error) {
+	for _, sig := range []string{st.BlackSig, st.WhiteSig} {
+		if len(sig) != 130 {
+			err = errors.New("Bad signature in channel state")
+			return
+		}
+		var vNum int64
+		vNum, err = strconv.ParseInt(sig[128:], 16, 64)
+		if err != nil {
+			return
+		}
+		v, rs, ss = append(v, int(vNum)), append(rs, sig[:64]), append(ss, sig[64:128])
+	}
+	return
+}
+
+func openChannel(ctx context.Context, contractAddr string, private string, st ChannelState) (err error) {
+	v, rs, ss, err := splitSigs(st)
+	if err != nil {
+		return
+	}
+	params := []interface{}{v, rs, ss}
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: params, GasLimit: 200000}, contractAddr, "openChannel")
+	return
+}
+
+func submitState(ctx context.Context, contractAddr string, private string, st ChannelState) (err error) {
+	v, rs, ss, err := splitSigs(st)
+	if err != nil {
+		return
+	}
+	params := []interface{}{st.Nonce, st.Moves, st.Result, v, rs, ss}
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: params, GasLimit: 200000}, contractAddr, "submitState")
+	return
+}
+
+func answerDispute(ctx context.Context, contractAddr string, private string, m ChannelMove) (hash string, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{m.X, m.Y}, GasLimit: 100000}, contractAddr, "answerDispute")
+	if err != nil {
+		return
+	}
+	hash = result.TXHash()
+	return
+}
+
+func finalizeDispute(ctx context.Context, contractAddr string, private string) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, GasLimit: 200000}, contractAddr, "finalizeDispute")
+	return
+}
+
+//constant channel methods
+func getChannelMode(ctx context.Context, contractAddr string) (mode bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "channelMode")
+	//older versions have no state channel mode
+	if err == errOlderVersion {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	mode = result.Results[0].(bool)
+	return
+}
+
+func getChannelNonce(ctx context.Context, contractAddr string) (nonce int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "channelNonce")
+	if err != nil {
+		return
+	}
+	num, err := result.Results[0].(json.Number).Int64()
+	if err != nil {
+		return
+	}
+	nonce = int(num)
+	return
+}
+
+func getDisputeDeadline(ctx context.Context, contractAddr string) (deadline int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "disputeDeadline")
+	//older versions can't be disputed
+	if err == errOlderVersion {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	num, err := result.Results[0].(json.Number).Int64()
+	if err != nil {
+		return
+	}
+	deadline = int(num)
+	return
+}
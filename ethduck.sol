@@ -3,6 +3,10 @@ pragma solidity ^0.4.0;
 /// @title EthDuck
 /// @author acityinohio
 contract EthDuck {
+	//bumped whenever the contract's interface changes, so the server can pick
+	//the right ABI for games published from older versions (which start at 1,
+	//the original contract without this getter)
+	uint8 constant public version = 2;
 	uint8 public size;
 	address public black;
 	address public white;
@@ -10,6 +14,9 @@ contract EthDuck {
 	bool public blackTurn;
 	bool public approvalLock;
 	bool public draw;
+	bool public sideBets;
+	//percent of the pot (not counting side bets) the winner gets, the loser gets the rest
+	uint8 public winnerShare;
 	enum State { Empty, Black, White }
 	struct Move {
 		uint8 x;
@@ -19,17 +26,83 @@ contract EthDuck {
 	Move[] moves;
 	Move public proposed;
 	State public winner;
+	//side bets on individual moves; stakes[n] is what each player put on the n-th move
+	uint[] public stakes;
+	uint public proposedStake;
+	uint public sideBetPot;
+	//optional nigiri: both players commit to a hashed secret, and revealing them picks colors
+	//nigiri stays true until colors are decided; no one can move until then
+	bool public nigiri;
+	bytes32 public blackCommit;
+	bytes32 public whiteCommit;
+	bytes32 blackSecret;
+	bytes32 whiteSecret;
+	bool public blackRevealed;
+	bool public whiteRevealed;
+	uint public revealDeadline;
+	//optional spectator market (see spectators.sol), told the result when the game settles
+	address public market;
+	bool initialized;
+	//the EthDuckFactory (see factory.sol) that cloned this game, 0 if it was published directly
+	address public factory;
+	//set once both players sign to play off-chain (see openChannel below);
+	//on-chain moves, winners and draws are refused from then on
+	bool public channelMode;
+	//latest state channel state submitted (see submitState below)
+	uint public channelNonce;
+	bytes32 public channelMoves;
+	uint public disputeDeadline;
+
+	//events, so a game's whole timeline can be rebuilt from its logs
+	event GameConfirmed(address indexed white, uint wager);
+	event MoveProposed(address indexed player, uint8 x, uint8 y, uint stake);
+	event MoveAuthorized(address indexed player, bool approved);
+	event WinnerProposed(address indexed player);
+	event WinnerAuthorized(address indexed player, bool approved);
+	event DrawProposed(address indexed player);
+	event DrawAuthorized(address indexed player, bool approved);
+	event NigiriRevealed(address indexed player);
+	event ColorsDecided(address indexed black, address indexed white);
+	event GameRefunded(uint refund);
+	event MarketSet(address indexed player, address market);
+	//result is 1 for black, 2 for white, 3 for a draw; payout is what the winner (or black, on a draw) got
+	event GameSettled(uint8 result, uint payout);
+	event ChannelOpened(address indexed player);
+	event ChannelDisputed(address indexed player, uint nonce);
 
 	//constructor for initializing contract, requires boardsize and opponent/"white" stone address
+	//player2 can be 0 for an open challenge that any address can accept
 	//note the "payable" identifier; new to Solidity 0.4.0 for any contract methods that accept wei
 	//the address that constructs the contract is the "black" stone player
 	//and their initial wager is the value sent with the constructor
-	//winner gets 3/4th of the pot, loser gets 1/4th, or they draw and split it
-	function EthDuck(uint8 boardSize, address player2) payable {
-		black = msg.sender;
+	//winner gets _winnerShare percent of the pot (50 to 100), loser gets the rest, or they draw and split it
+	//if _sideBets is true, players can also bet on individual moves
+	//if _commit is nonzero (sha3 of a secret), colors are decided by nigiri after white confirms
+	function EthDuck(uint8 boardSize, address player2, uint8 _winnerShare, bool _sideBets, bytes32 _commit) payable {
+		initGame(msg.sender, boardSize, player2, _winnerShare, _sideBets, _commit);
+	}
+
+	//sets up the game, only once; clones made by EthDuckFactory (see factory.sol) skip
+	//the constructor, so the factory calls this instead with the creator as player1
+	function initGame(address player1, uint8 boardSize, address player2, uint8 _winnerShare, bool _sideBets, bytes32 _commit) payable {
+		if (initialized || _winnerShare < 50 || _winnerShare > 100) {
+			throw;
+		}
+		initialized = true;
+		//the constructor calls this as black, the factory as itself
+		if (msg.sender != player1) {
+			factory = msg.sender;
+		}
+		winnerShare = _winnerShare;
+		black = player1;
 		white = player2;
 		size = boardSize;
+		sideBets = _sideBets;
+		if (_commit != 0) {
+			(nigiri, blackCommit) = (true, _commit);
+		}
 	}
+
 	//make fallback function payable just in case players want to add more to the pot
 	//uses onlyPlayers modifier to ensure no one else can send value to this contract
 	function () payable
@@ -40,21 +113,113 @@ contract EthDuck {
 	//confirms game for white player; requires them to bet at least as much as black player
 	//"confirm" bool is used as a check for "refundGame" below
 	//also sets blackTurn to true, to let black move first
-	function confirmNewGame() payable {
-		if (msg.value < this.balance / 2 || msg.sender != white) {
+	//if white was left unset it's an open challenge, and whoever confirms first becomes white,
+	//and is added to the factory's registry of their games if the game was cloned through one
+	//in nigiri games white commits to their own secret here, and black waits for the reveal
+	function confirmNewGame(bytes32 _commit) payable {
+		bool _open = white == 0;
+		if (_open && msg.sender != black) {
+			white = msg.sender;
+		}
+		if (confirmed || msg.value < this.balance / 2 || msg.sender != white) {
 			throw;
+		}
+		if (_open && factory != 0) {
+			if (!factory.call(bytes4(sha3("addPlayerGame(address)")), white)) {
+				throw;
+			}
+		}
+		if (nigiri) {
+			if (_commit == 0) {
+				throw;
+			}
+			(confirmed, whiteCommit, revealDeadline) = (true, _commit, block.number + 240);
 		} else {
 			(confirmed, blackTurn) = (true, true);
 		}
+		GameConfirmed(white, msg.value);
+	}
+
+	//reveals a player's nigiri secret; once both are revealed, their combined hash
+	//decides if the players swap colors
+	function reveal(bytes32 _secret)
+	onlyPlayers()
+	{
+		if (!nigiri || !confirmed) {
+			throw;
+		}
+		if (msg.sender == black && !blackRevealed && sha3(_secret) == blackCommit) {
+			(blackSecret, blackRevealed) = (_secret, true);
+		} else if (msg.sender == white && !whiteRevealed && sha3(_secret) == whiteCommit) {
+			(whiteSecret, whiteRevealed) = (_secret, true);
+		} else {
+			throw;
+		}
+		NigiriRevealed(msg.sender);
+		if (blackRevealed && whiteRevealed) {
+			finishNigiri(uint(sha3(blackSecret, whiteSecret)) % 2 == 1);
+		}
+	}
+
+	//if only one player revealed by the deadline, the other forfeits and that player wins
+	//the game outright; the last to reveal can work out the colors from the first reveal,
+	//so letting them sit it out must cost them more than any color could be worth
+	function claimNigiri()
+	onlyPlayers()
+	{
+		if (!nigiri || !confirmed || block.number <= revealDeadline) {
+			throw;
+		}
+		if (msg.sender == black && blackRevealed && !whiteRevealed) {
+			settleGame(1);
+		} else if (msg.sender == white && whiteRevealed && !blackRevealed) {
+			settleGame(2);
+		} else {
+			throw;
+		}
+	}
+
+	//settles colors, swapping them if needed, and lets black move first
+	function finishNigiri(bool _swap) private {
+		if (_swap) {
+			(black, white) = (white, black);
+		}
+		(nigiri, blackTurn) = (false, true);
+		ColorsDecided(black, white);
 	}
 
 	//allows black player to refund/self-destruct contract if white doesn't confirmNewGame()
+	//a market can't be attached before confirming, but it's voided all the same
 	function refundGame() {
 		if (msg.sender == black && !confirmed) {
+			settleMarket(3);
+			GameRefunded(this.balance);
 			selfdestruct(black);
 		}
 	}
 
+	//lets a player attach a spectator market to the game, only once, and only once
+	//the game is confirmed and colors are decided, so backers know who they're backing
+	function setMarket(address _market)
+	onlyPlayers()
+	{
+		if (market != 0 || !confirmed || nigiri) {
+			throw;
+		}
+		market = _market;
+		MarketSet(msg.sender, _market);
+	}
+
+	//tells the spectator market the result: 1 black, 2 white, 3 draw
+	//a player can attach any contract as the market, so gas is capped and a failed
+	//settle is ignored, otherwise a loser could lock the pot with one that throws;
+	//backers of a market that never settles get refunded after its refundBlock
+	function settleMarket(uint8 _result) private {
+		if (market != 0) {
+			market.call.gas(50000)(bytes4(sha3("settle(uint8)")), _result);
+		}
+	}
+
 	//gets number of moves
 	function getNumMoves() constant returns (uint _moves) {
 		_moves = moves.length;
@@ -72,20 +237,59 @@ contract EthDuck {
 
 	//modifier to restrict moves to players
 	modifier onlyPlayers() { if (msg.sender != black && msg.sender != white) { throw; } _; }
-	//modifier to restrict function to players when its their turn to propose
-	modifier onlyPropose() { if (approvalLock || (msg.sender == black && !blackTurn) || (msg.sender == white && blackTurn)) { throw; } _; }
-	//modifier to restrict function to authorizers
-	modifier onlyAuthorize() { if (!approvalLock || (msg.sender == black && blackTurn) || (msg.sender == white && !blackTurn)) { throw; } _; }  
+	//modifier to restrict function to players when its their turn to propose, and not in state channel mode
+	modifier onlyPropose() { if (channelMode || nigiri || approvalLock || (msg.sender == black && !blackTurn) || (msg.sender == white && blackTurn)) { throw; } _; }
+	//modifier to restrict function to authorizers, and not in state channel mode
+	modifier onlyAuthorize() { if (channelMode || !approvalLock || (msg.sender == black && blackTurn) || (msg.sender == white && !blackTurn)) { throw; } _; }  
 	//modifier to restrict size
 	modifier onlySize(uint8 _x, uint8 _y) { if (_x >= size || _y >= size) { throw; } _; }
 
 	//proposes move for a player, and with the modifiers above, only on their turn and within the board
-	function proposeMove(uint8 _x, uint8 _y)
+	//in side bet mode, the value sent is the stake on this move, which the opponent must match
+	function proposeMove(uint8 _x, uint8 _y) payable
 	onlyPlayers()
 	onlyPropose()
 	onlySize(_x, _y)
 	{
+		makeMove(_x, _y, msg.value);
+	}
+
+	//a player can authorize move, when it's their turn
+	//once they authorize, it's added to the "moves" array
+	//approving must match the proposed stake exactly; rejecting refunds the proposer's stake
+	function authorizeMove(bool _approve) payable
+	onlyPlayers()
+	onlyAuthorize()
+	{
+		if (msg.value != (_approve ? proposedStake : 0)) {
+			throw;
+		}
+		approveMove(_approve);
+	}
+
+	//approves the opponent's proposed move and proposes the next one in one transaction
+	//the value sent matches the proposed stake, and anything over it is the new move's stake
+	function authorizeAndPropose(uint8 _x, uint8 _y) payable
+	onlyPlayers()
+	onlyAuthorize()
+	onlySize(_x, _y)
+	{
+		uint _match = proposedStake;
+		if (draw || winner != State.Empty || msg.value < _match) {
+			throw;
+		}
+		approveMove(true);
+		//approving made it the sender's turn to propose
+		makeMove(_x, _y, msg.value - _match);
+	}
+
+	//proposes the move for the sender, with _stake as its side bet
+	function makeMove(uint8 _x, uint8 _y, uint _stake) private {
+		if (!sideBets && _stake > 0) {
+			throw;
+		}
 		approvalLock = true;
+		proposedStake = _stake;
 		State _color;
 		if (msg.sender == black) {
 			_color = State.Black;
@@ -93,20 +297,30 @@ contract EthDuck {
 			_color = State.White;
 		}
 		proposed = Move(_x, _y, _color);
+		MoveProposed(msg.sender, _x, _y, _stake);
 	}
 
-	//a player can authorize move, when it's their turn
-	//once they authorize, it's added to the "moves" array
-	function authorizeMove(bool _approve) 
-	onlyPlayers()
-	onlyAuthorize()
-	{
+	//adds the proposed move if approved, otherwise refunds its stake to the proposer
+	//the caller checked the approver sent the matching stake
+	function approveMove(bool _approve) private {
+		uint _stake = proposedStake;
 		if (_approve) {
 			moves.push(proposed);
+			if (sideBets) {
+				stakes.push(_stake);
+				sideBetPot += 2 * _stake;
+			}
 			blackTurn = !blackTurn;
 		}
 		delete proposed;
+		proposedStake = 0;
 		approvalLock = false;
+		MoveAuthorized(msg.sender, _approve);
+		if (!_approve && _stake > 0) {
+			if (!(msg.sender == black ? white : black).send(_stake)) {
+				throw;
+			}
+		}
 	}
 
 	//after enough playtime, when it's their move, a player can propose that they won
@@ -120,6 +334,7 @@ contract EthDuck {
 			winner = State.White;
 		}
 		approvalLock = true;
+		WinnerProposed(msg.sender);
 	}
 
 	//authorizes winner after proposed, self-destructs contract
@@ -131,23 +346,14 @@ contract EthDuck {
 		if (winner == State.Empty) {
 			return;
 		}
+		WinnerAuthorized(msg.sender, _approve);
 		//if not approved, reset approval lock and delete winner
 		if (!_approve){
 			delete winner;
 			approvalLock = false;
 			return;
 		}
-		if (winner == State.Black) {
-			if (!black.send(3 * this.balance / 4)) {
-				throw;
-			}
-			selfdestruct(white);
-		} else if (winner == State.White) {
-			if (!white.send(3 * this.balance / 4)) {
-				throw;
-			}
-			selfdestruct(black);
-		}
+		settleGame(uint8(winner));
 	}
 
 	//after enough playtime, when it's their move, a player can propose a draw
@@ -157,6 +363,7 @@ contract EthDuck {
 	{
 		draw = true;
 		approvalLock = true;
+		DrawProposed(msg.sender);
 	}
 
 	//authorizes draw after proposed, self-destructs contract
@@ -167,14 +374,134 @@ contract EthDuck {
 		if (!draw) {
 			return;
 		}
+		DrawAuthorized(msg.sender, _approve);
 		if (_approve) {
+			settleGame(3);
+		} else {
+			draw = false;
+			approvalLock = false;
+		}
+	}
+
+	//pays out the pot and self-destructs: 1 black won, 2 white won, 3 draw
+	//side bets are settled with the game: the winner takes the whole side bet pot
+	//both players matched every side bet, so splitting the balance on a draw returns them too
+	function settleGame(uint8 _result) private {
+		settleMarket(_result);
+		if (_result == 3) {
+			GameSettled(3, this.balance / 2);
 			if (!black.send(this.balance / 2)) {
 				throw;
 			}
 			selfdestruct(white);
+		}
+		uint _payout = winnerShare * (this.balance - sideBetPot) / 100 + sideBetPot;
+		GameSettled(_result, _payout);
+		if (_result == 1) {
+			if (!black.send(_payout)) {
+				throw;
+			}
+			selfdestruct(white);
+		} else if (_result == 2) {
+			if (!white.send(_payout)) {
+				throw;
+			}
+			selfdestruct(black);
+		}
+	}
+
+	//state channel mode: players sign game states off-chain (through the ethduck server)
+	//and only come to the contract to settle, or to dispute with the latest state both signed
+	//a state is sha3(this, nonce, moves, result): nonce counts signed states, moves is the
+	//hash chain sha3(moves, x, y, color) of every move, result is 0 while playing or like settleGame
+	//every state that doesn't finish the game adds one move, so nonce is also the move count
+	function channelHash(uint _nonce, bytes32 _moves, uint8 _result) constant returns (bytes32 _hash) {
+		_hash = sha3(this, _nonce, _moves, _result);
+	}
+
+	//checks a state hash was signed by both players, signatures are [black, white]
+	function signedByBoth(bytes32 _hash, uint8[2] _v, bytes32[2] _r, bytes32[2] _s) private constant returns (bool _signed) {
+		_signed = ecrecover(_hash, _v[0], _r[0], _s[0]) == black && ecrecover(_hash, _v[1], _r[1], _s[1]) == white;
+	}
+
+	//switches a confirmed game with no moves yet to state channel mode, once both players
+	//signed the opening state (nonce 0, no moves); the contract refuses on-chain play after that
+	function openChannel(uint8[2] _v, bytes32[2] _r, bytes32[2] _s)
+	onlyPlayers()
+	{
+		if (!confirmed || nigiri || approvalLock || channelMode || moves.length > 0) {
+			throw;
+		}
+		if (!signedByBoth(channelHash(0, 0, 0), _v, _r, _s)) {
+			throw;
+		}
+		channelMode = true;
+		ChannelOpened(msg.sender);
+	}
+
+	//the player who moves next in the channel; black moves on even nonces
+	function channelTurn() constant returns (address _player) {
+		if (channelNonce % 2 == 0) {
+			_player = black;
 		} else {
-			draw = false;
-			approvalLock = false;
+			_player = white;
+		}
+	}
+
+	//submits a state signed by both players; a finished state settles right away, an unfinished
+	//one starts (or extends) a dispute, answered by a newer state or by the player whose turn
+	//it is moving on-chain (see answerDispute); the opening state can start a dispute too
+	function submitState(uint _nonce, bytes32 _moves, uint8 _result, uint8[2] _v, bytes32[2] _r, bytes32[2] _s)
+	onlyPlayers()
+	{
+		if (!channelMode || _result > 3 || _nonce < channelNonce || (_nonce == channelNonce && disputeDeadline != 0)) {
+			throw;
+		}
+		if (!signedByBoth(channelHash(_nonce, _moves, _result), _v, _r, _s)) {
+			throw;
+		}
+		(channelNonce, channelMoves) = (_nonce, _moves);
+		if (_result != 0) {
+			settleGame(_result);
+		}
+		disputeDeadline = block.number + 240;
+		ChannelDisputed(msg.sender, _nonce);
+	}
+
+	//once disputed, play resumes on-chain from the disputed state: the player whose turn it is
+	//answers with their move, extending the move chain, and the opponent gets a new deadline
+	//to answer in turn; the server doesn't check the move is legal, neither does this
+	function answerDispute(uint8 _x, uint8 _y)
+	onlyPlayers()
+	onlySize(_x, _y)
+	{
+		if (disputeDeadline == 0 || block.number > disputeDeadline || msg.sender != channelTurn()) {
+			throw;
+		}
+		State _color;
+		if (msg.sender == black) {
+			_color = State.Black;
+		} else {
+			_color = State.White;
+		}
+		channelMoves = sha3(channelMoves, _x, _y, uint8(_color));
+		channelNonce++;
+		disputeDeadline = block.number + 240;
+		ChannelDisputed(msg.sender, channelNonce);
+	}
+
+	//once a dispute's deadline passes unanswered, the player whose turn it was forfeits,
+	//so refusing to sign (or to move) can't win anyone anything
+	function finalizeDispute()
+	onlyPlayers()
+	{
+		if (disputeDeadline == 0 || block.number <= disputeDeadline) {
+			throw;
+		}
+		if (channelTurn() == black) {
+			settleGame(2);
+		} else {
+			settleGame(1);
 		}
 	}
 }
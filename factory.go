@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//address of the EthDuckFactory (see factory.sol) new games are cloned through,
+//set with the -factory flag; games are published from scratch if it's empty
+var factoryAddr string
+
+//publishFactory publishes an EthDuckFactory, along with the EthDuck
+//template it clones games from
+func publishFactory(ctx context.Context, private string) (addr string, err error) {
+	contract := bcyeth.Contract{
+		Private:  private,
+		Bin:      contracts["EthDuckFactory"].Bin,
+		ABI:      contracts["EthDuckFactory"].ABI,
+		GasLimit: 6000000,
+	}
+	result, err := bcy.CreateContractContext(ctx, contract)
+	if err != nil {
+		return
+	}
+	addr = result[0].Address
+	return
+}
+
+//games being created through the factory, by the hash of their newGame transaction;
+//like the lobby, these are lost on restart, but the lobby sync finds the games
+var created struct {
+	sync.Mutex
+	games map[string]*CreatedGame
+}
+
+//CreatedGame is a game created through the factory; ContractAddr is
+//empty until its transaction is mined, or Err is set if that fails
+type CreatedGame struct {
+	ContractAddr string
+	Err          error
+}
+
+func init() {
+	created.games = make(map[string]*CreatedGame)
+}
+
+//the factory's GameCreated event, which is where a clone's address comes from
+var gameCreated bcyeth.Event
+
+func init() {
+	var err error
+	gameCreated, err = bcyeth.ParseEvent("GameCreated(address indexed game, address indexed black, address indexed white)")
+	if err != nil {
+		panic(err)
+	}
+}
+
+//newFactoryGame creates a game through the factory, with the same parameters as publishEthDuck;
+//a contract call doesn't return the clone's address, so it's read from the GameCreated event
+//of the mined transaction in the background, and the game is followed at /created/{txHash}
+func newFactoryGame(ctx context.Context, blackPriv string, whiteAddr string, size int, wager big.Int, winnerShare int, sideBets bool, commit string, open bool) (txHash string, err error) {
+	contract := bcyeth.Contract{
+		Private:  blackPriv,
+		Params:   []interface{}{size, whiteAddr, winnerShare, sideBets, commit},
+		Value:    wager,
+		GasLimit: 500000,
+	}
+	result, err := bcy.CallContractContext(ctx, contract, factoryAddr, "newGame")
+	if err != nil {
+		return
+	}
+	txHash = result.TXHash()
+	created.Lock()
+	created.games[txHash] = new(CreatedGame)
+	created.Unlock()
+	listTX(txHash, "publish", txHash)
+	go followFactoryGame(txHash, &wager, open)
+	return
+}
+
+//followFactoryGame waits for a newGame transaction, and adds its game to the lobby
+func followFactoryGame(txHash string, wager *big.Int, open bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), pendingTimeout)
+	defer cancel()
+	contractAddr, err := factoryGameAddr(ctx, txHash)
+	untrackTX(txHash, txHash)
+	created.Lock()
+	created.games[txHash].ContractAddr, created.games[txHash].Err = contractAddr, err
+	created.Unlock()
+	if err != nil {
+		log.Printf("creating game in %s: %v", txHash, err)
+		return
+	}
+	addLobbyGame(contractAddr, wager, open)
+}
+
+//factoryGameAddr is the address of the game a mined newGame transaction created
+func factoryGameAddr(ctx context.Context, txHash string) (contractAddr string, err error) {
+	if _, err = bcy.WaitForConfirmationsContext(ctx, txHash, 1); err != nil {
+		return
+	}
+	logs, err := bcyeth.GetTXLogsContext(ctx, bcy.Client, rpcURL, txHash)
+	if err != nil {
+		return
+	}
+	for _, l := range logs {
+		if !strings.EqualFold(strings.TrimPrefix(l.Address, "0x"), strings.TrimPrefix(factoryAddr, "0x")) || len(l.Topics) == 0 || !strings.EqualFold(l.Topics[0], gameCreated.Topic()) {
+			continue
+		}
+		var args map[string]interface{}
+		args, err = gameCreated.Decode(l)
+		if err != nil {
+			return
+		}
+		contractAddr = args["game"].(string)
+		return
+	}
+	err = errors.New("transaction " + txHash + " didn't create a game, it may have thrown")
+	return
+}
+
+//createdHandler follows a game being created through the factory,
+//at /created/{txHash}, until it can send the player to the game
+func createdHandler(w http.ResponseWriter, r *http.Request) {
+	txHash := r.URL.Path[len("/created/"):]
+	created.Lock()
+	g, ok := created.games[txHash]
+	var game CreatedGame
+	if ok {
+		game = *g
+	}
+	created.Unlock()
+	if !ok {
+		http.Error(w, "No game is being created in that transaction", http.StatusNotFound)
+		return
+	}
+	if game.Err != nil {
+		serveError(w, game.Err)
+		return
+	}
+	if game.ContractAddr != "" {
+		http.Redirect(w, r, "/games/"+game.ContractAddr, http.StatusFound)
+		return
+	}
+	//reload until it's mined
+	w.Header().Set("Refresh", "15")
+	fmt.Fprintf(w, "Game created in transaction %s , waiting for it to be mined. This page reloads until then, and takes you to the game.", txHash)
+}
+
+//how far into the factory's registry the lobby has synced; the registry
+//only grows, so each sync just fetches the games added since the last one,
+//and retries those that couldn't be read last time
+var factorySync struct {
+	sync.Mutex
+	synced int
+	failed []string
+}
+
+//syncLobby adds games from the factory's registry that the lobby doesn't
+//know yet, so it survives restarts and shows games made through other servers;
+//it only fails if the registry can't be read, games that can't be are skipped
+func syncLobby(ctx context.Context) (err error) {
+	//a sync already running will pick up the new games
+	if !factorySync.TryLock() {
+		return
+	}
+	defer factorySync.Unlock()
+	numGames, err := getNumFactoryGames(ctx)
+	if err != nil {
+		return
+	}
+	retry := factorySync.failed
+	factorySync.failed = nil
+	for ; factorySync.synced < numGames; factorySync.synced++ {
+		contractAddr, indexErr := getFactoryGame(ctx, factorySync.synced)
+		if indexErr != nil {
+			//read the registry from here next sync
+			log.Printf("reading game %d from factory %s: %v", factorySync.synced, factoryAddr, indexErr)
+			break
+		}
+		retry = append(retry, contractAddr)
+	}
+	for _, contractAddr := range retry {
+		g, gameErr := factoryLobbyGame(ctx, contractAddr)
+		if bcyeth.IsNotFound(gameErr) || bcyeth.IsThrow(gameErr) {
+			//settled and refunded games self-destruct, there's nothing to list
+			continue
+		}
+		if gameErr != nil {
+			log.Printf("reading factory game %s: %v", contractAddr, gameErr)
+			factorySync.failed = append(factorySync.failed, contractAddr)
+			continue
+		}
+		listLobbyGame(g)
+	}
+	return
+}
+
+//factoryLobbyGame reads a game from the factory's registry for the lobby
+func factoryLobbyGame(ctx context.Context, contractAddr string) (g LobbyGame, err error) {
+	g.ContractAddr = contractAddr
+	g.Created, err = getCreatedAt(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	addr, err := bcy.GetAddrBalContext(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	g.Wager = &addr.Balance
+	white, err := getWhite(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	g.Open = white == openWhite
+	return
+}
+
+//constant factory methods
+func getNumFactoryGames(ctx context.Context) (numGames int, err error) {
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, factoryAddr, "getNumGames")
+	if err != nil {
+		return
+	}
+	num, err := result.Results[0].(json.Number).Int64()
+	if err != nil {
+		return
+	}
+	numGames = int(num)
+	return
+}
+
+func getFactoryGame(ctx context.Context, n int) (contractAddr string, err error) {
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", Params: []interface{}{n}}, factoryAddr, "games")
+	if err != nil {
+		return
+	}
+	contractAddr = strings.TrimPrefix(result.Results[0].(string), "0x")
+	return
+}
+
+func getCreatedAt(ctx context.Context, contractAddr string) (created time.Time, err error) {
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", Params: []interface{}{contractAddr}}, factoryAddr, "createdAt")
+	if err != nil {
+		return
+	}
+	num, err := result.Results[0].(json.Number).Int64()
+	if err != nil {
+		return
+	}
+	created = time.Unix(num, 0)
+	return
+}
@@ -0,0 +1,75 @@
+pragma solidity ^0.4.0;
+
+import "./ethduck.sol";
+
+/// @title EthDuckFactory
+/// @author acityinohio
+contract EthDuckFactory {
+	//the game every clone delegates to; the factory is both its players,
+	//so no one can settle or refund (self-destruct) it out from under the clones
+	EthDuck public template;
+	address[] public games;
+	mapping (address => uint) public createdAt;
+	mapping (address => address[]) playerGames;
+
+	event GameCreated(address indexed game, address indexed black, address indexed white);
+
+	function EthDuckFactory() {
+		template = new EthDuck(0, this, 100, false, 0);
+	}
+
+	//creates a game as a minimal proxy clone of the template, with the same
+	//parameters (and wager) as the EthDuck constructor; the sender is black
+	function newGame(uint8 boardSize, address player2, uint8 _winnerShare, bool _sideBets, bytes32 _commit) payable returns (address _game) {
+		_game = createClone(template);
+		EthDuck(_game).initGame.value(msg.value)(msg.sender, boardSize, player2, _winnerShare, _sideBets, _commit);
+		games.push(_game);
+		createdAt[_game] = now;
+		playerGames[msg.sender].push(_game);
+		if (player2 != 0) {
+			playerGames[player2].push(_game);
+		}
+		GameCreated(_game, msg.sender, player2);
+	}
+
+	//called by a game when someone accepts its open challenge, indexing them as its white
+	function addPlayerGame(address _white) {
+		if (createdAt[msg.sender] == 0) {
+			throw;
+		}
+		playerGames[_white].push(msg.sender);
+	}
+
+	//gets number of games created by the factory
+	function getNumGames() constant returns (uint _games) {
+		_games = games.length;
+	}
+
+	//gets number of games a player was created into, as black or as white, or accepted as white
+	function getNumPlayerGames(address _player) constant returns (uint _games) {
+		_games = playerGames[_player].length;
+	}
+
+	//gets n-th game of a player
+	function getPlayerGame(address _player, uint _n) constant returns (address _game) {
+		if (_n >= playerGames[_player].length) {
+			throw;
+		}
+		_game = playerGames[_player][_n];
+	}
+
+	//deploys an EIP-1167 minimal proxy that delegates every call to _target
+	function createClone(address _target) private returns (address _clone) {
+		bytes20 _targetBytes = bytes20(_target);
+		assembly {
+			let code := mload(0x40)
+			mstore(code, 0x3d602d80600a3d3981f3363d3d373d3d3d363d73000000000000000000000000)
+			mstore(add(code, 0x14), _targetBytes)
+			mstore(add(code, 0x28), 0x5af43d82803e903d91602b57fd5bf30000000000000000000000000000000000)
+			_clone := create(0, code, 0x37)
+		}
+		if (_clone == 0) {
+			throw;
+		}
+	}
+}
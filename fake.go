@@ -0,0 +1,18 @@
+//go:build fake
+
+package main
+
+import (
+	"github.com/acityinohio/ethduck/bcyeth"
+	"github.com/acityinohio/ethduck/bcyeth/bcyethtest"
+)
+
+//only builds with -tags fake get the -fake flag, so release
+//binaries don't carry the fake and its test HTTP server
+func init() {
+	startFake = func() (api bcyeth.API, stop func()) {
+		server := bcyethtest.NewServer()
+		api, stop = server.API(), server.Close
+		return
+	}
+}
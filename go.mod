@@ -0,0 +1,14 @@
+module github.com/acityinohio/ethduck
+
+go 1.22
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.31.0
+)
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+)
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//how many transactions the game page shows at a time
+const historyPageSize = 10
+
+//GameTX is a transaction sent to or from a game contract
+type GameTX struct {
+	Hash          string
+	Block         int
+	From          string
+	Value         *big.Int
+	Confirmations int
+}
+
+//gameHistory is a page of a game contract's transactions, newest first,
+//starting before block before ("" for the latest), leaving out the comma
+//separated hashes in seen; next is the query string of the page after
+//it, "" if it's the last one
+func gameHistory(ctx context.Context, contractAddr string, before string, seen string) (history []GameTX, next string, err error) {
+	params := map[string]string{"limit": strconv.Itoa(historyPageSize)}
+	if before != "" {
+		params["before"] = before
+		params["seen"] = seen
+	}
+	addr, err := bcy.GetAddrFullContext(bcyeth.ReadOnly(ctx), contractAddr, params)
+	if err != nil {
+		return
+	}
+	for _, tx := range addr.TXs {
+		gtx := GameTX{
+			Hash:          tx.Hash,
+			Block:         tx.BlockHeight,
+			Value:         new(big.Int).Set(&tx.Total),
+			Confirmations: tx.Confirmations,
+		}
+		var from []string
+		for _, in := range tx.Inputs {
+			from = append(from, in.Addresses...)
+		}
+		gtx.From = strings.Join(from, ", ")
+		history = append(history, gtx)
+	}
+	if page := addr.NextPage(historyPageSize); page != nil {
+		next = url.Values{"before": {page["before"]}, "seen": {page["seen"]}}.Encode()
+	}
+	return
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//public URL of this server for BlockCypher's webhooks, set with the -hooks
+//flag; without it, every game page is fetched fresh from the contract
+var hooksURL string
+
+//BlockCypher's event stream, if the -stream flag is set; games
+//are watched through it instead of hooks, with no public URL needed
+var stream *bcyeth.Stream
+
+//hookSecret is in the URL of every hook this server registers, so only
+//BlockCypher can mark games as changed; it's new each run, so hooks
+//from earlier runs are deleted on start
+var hookSecret string
+
+//hooks (or stream subscriptions) watching games, and the state of
+//watched games, by game address; a game's cached state is dropped
+//whenever its hook says a transaction to or from it was mined, and
+//gens counts those drops
+var watched struct {
+	sync.Mutex
+	hooks   map[string]string
+	streams map[string]context.CancelFunc
+	games   map[string]Game
+	gens    map[string]int
+}
+
+func init() {
+	watched.hooks = make(map[string]string)
+	watched.streams = make(map[string]context.CancelFunc)
+	watched.games = make(map[string]Game)
+	watched.gens = make(map[string]int)
+}
+
+//initHooks makes this run's hookSecret, and deletes hooks an earlier run left
+func initHooks(ctx context.Context) (err error) {
+	hooksURL = strings.TrimSuffix(hooksURL, "/")
+	raw := make([]byte, 16)
+	if _, err = rand.Read(raw); err != nil {
+		return
+	}
+	hookSecret = hex.EncodeToString(raw)
+	hooks, err := bcy.ListHooksContext(ctx)
+	if err != nil {
+		return
+	}
+	for _, hook := range hooks {
+		if strings.HasPrefix(hook.URL, hooksURL+"/hooks/") {
+			if err = bcy.DeleteHookContext(ctx, hook.ID); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+//watchGame registers a hook for transactions mined to or from a game,
+//or subscribes to them on the event stream; fresh is false if it
+//was already watched
+func watchGame(ctx context.Context, contractAddr string) (fresh bool, err error) {
+	watched.Lock()
+	_, hooked := watched.hooks[contractAddr]
+	_, subscribed := watched.streams[contractAddr]
+	if stream != nil && !subscribed {
+		subCtx, cancel := context.WithCancel(context.Background())
+		watched.streams[contractAddr] = cancel
+		events := stream.Subscribe(subCtx, bcyeth.Subscription{Event: bcyeth.ConfirmedTX, Address: contractAddr})
+		go func() {
+			for ev := range events {
+				gameChanged(contractAddr, ev.TX.Hash)
+			}
+		}()
+		fresh = true
+	}
+	watched.Unlock()
+	if stream != nil || hooked {
+		return
+	}
+	hook, err := bcy.CreateHookContext(ctx, bcyeth.Hook{
+		Event:   bcyeth.ConfirmedTX,
+		Address: contractAddr,
+		URL:     hooksURL + "/hooks/" + contractAddr + "?secret=" + hookSecret,
+	})
+	if err != nil {
+		return
+	}
+	watched.Lock()
+	_, hooked = watched.hooks[contractAddr]
+	if !hooked {
+		watched.hooks[contractAddr] = hook.ID
+	}
+	watched.Unlock()
+	//another request may have beaten this one to it
+	if hooked {
+		err = bcy.DeleteHookContext(ctx, hook.ID)
+		return
+	}
+	fresh = true
+	return
+}
+
+//unwatchGame deletes a game's hook or subscription, once its contract is gone
+func unwatchGame(ctx context.Context, contractAddr string) (err error) {
+	watched.Lock()
+	if cancel, ok := watched.streams[contractAddr]; ok {
+		cancel()
+		delete(watched.streams, contractAddr)
+	}
+	id, ok := watched.hooks[contractAddr]
+	delete(watched.hooks, contractAddr)
+	delete(watched.games, contractAddr)
+	watched.Unlock()
+	if !ok {
+		return
+	}
+	err = bcy.DeleteHookContext(ctx, id)
+	return
+}
+
+//streamReconnected drops every cached game, since the transactions
+//mined while the stream was disconnected were never seen
+func streamReconnected() {
+	watched.Lock()
+	//games being fetched right now may be stale too
+	for contractAddr := range watched.streams {
+		watched.gens[contractAddr]++
+	}
+	watched.games = make(map[string]Game)
+	watched.Unlock()
+}
+
+//loadGame is remakeGame, served from the cache for watched games
+func loadGame(ctx context.Context, contractAddr string) (game Game, err error) {
+	if hooksURL == "" && stream == nil {
+		return remakeGame(ctx, contractAddr)
+	}
+	//while the stream is down, changes to cached games go unseen; they're
+	//dropped when it reconnects, until then games are fetched fresh
+	if stream != nil && !stream.Connected() {
+		return remakeGame(ctx, contractAddr)
+	}
+	contractAddr = strings.ToLower(strings.TrimPrefix(contractAddr, "0x"))
+	watched.Lock()
+	game, cached := watched.games[contractAddr]
+	gen := watched.gens[contractAddr]
+	watched.Unlock()
+	if cached {
+		return
+	}
+	game, err = remakeGame(ctx, contractAddr)
+	if bcyeth.IsNotFound(err) {
+		//settled and refunded games self-destruct
+		if hookErr := unwatchGame(ctx, contractAddr); hookErr != nil {
+			log.Printf("deleting hook for %s: %v", contractAddr, hookErr)
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	//the page still works without a hook, it just isn't cached
+	fresh, hookErr := watchGame(ctx, contractAddr)
+	if hookErr != nil {
+		log.Printf("registering hook for %s: %v", contractAddr, hookErr)
+		return
+	}
+	//a transaction mined before the hook was registered went unnoticed,
+	//so state fetched before then isn't cached
+	if fresh {
+		return
+	}
+	//nor is state fetched if the stream went down in the meantime
+	if stream != nil && !stream.Connected() {
+		return
+	}
+	watched.Lock()
+	//don't cache state a hook made stale while it was being fetched
+	if watched.gens[contractAddr] == gen {
+		watched.games[contractAddr] = game
+	}
+	watched.Unlock()
+	return
+}
+
+//hookHandler receives BlockCypher's webhooks for games, at /hooks/{contractAddr}
+func hookHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := strings.ToLower(r.URL.Path[len("/hooks/"):])
+	if r.Method != "POST" || r.FormValue("secret") != hookSecret || hookSecret == "" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	var tx bcyeth.TX
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gameChanged(contractAddr, tx.Hash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//gameChanged drops a game's cached state, after a transaction to or from it was mined
+func gameChanged(contractAddr string, hash string) {
+	watched.Lock()
+	delete(watched.games, contractAddr)
+	watched.gens[contractAddr]++
+	watched.Unlock()
+	untrackTX(contractAddr, hash)
+}
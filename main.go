@@ -1,59 +1,258 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"math"
 	"math/big"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
-	"./bcyeth"
-	"./bcytoken"
+	"github.com/acityinohio/ethduck/bcyeth"
+	"github.com/acityinohio/ethduck/bcytoken"
 
 	"github.com/acityinohio/baduk"
 )
 
 type Game struct {
+	ContractAddr  string
+	Version       int
+	Confirmed     bool
+	BlackTurn     bool
+	ApprovalLock  bool
+	Draw          bool
+	Winner        int
+	BlackScore    int
+	WhiteScore    int
+	ProposedMove  string
+	NumMoves      int
+	Nigiri        bool
+	BlackRevealed bool
+	WhiteRevealed bool
+	WinnerShare   int
+	SideBets      bool
+	Stakes        []Stake
+	ProposedStake *big.Int
+	SideBetPot    *big.Int
+	Pot           *big.Int
+	WinnerPayout  *big.Int
+	LoserPayout   *big.Int
+	State         baduk.Board
+}
+
+//Stake is a side bet both players matched on a move
+type Stake struct {
+	Move  int
+	Color string
+	X     int
+	Y     int
+	Value *big.Int
+}
+
+//LobbyGame is a game published through this server, listed on the index page
+type LobbyGame struct {
 	ContractAddr string
+	Created      time.Time
+	Wager        *big.Int
+	Open         bool
 	Confirmed    bool
-	BlackTurn    bool
-	ApprovalLock bool
-	Draw         bool
-	Winner       int
-	BlackScore   int
-	WhiteScore   int
-	ProposedMove string
-	State        baduk.Board
+	Refundable   bool
+	//Unchecked is set if the contract couldn't be checked this time
+	Unchecked bool
 }
 
-var templates = template.Must(template.ParseGlob("templates/*"))
+//white address of an open challenge, which anyone can accept
+const openWhite = "0000000000000000000000000000000000000000"
+
+//how long black waits on white before the lobby offers a refund
+const refundAfter = 24 * time.Hour
+
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*"))
 var bcy bcyeth.API
 
-func init() {
-	bcy = bcyeth.API{bcytoken.Token}
+//games published since the server started; no permanent memory state,
+//so this is lost on restart (the contracts themselves are not)
+var lobby struct {
+	sync.Mutex
+	games []LobbyGame
 }
 
+//startFake starts an in-memory fake of BlockCypher, see fake.go; it's
+//nil unless built with -tags fake
+var startFake func() (api bcyeth.API, stop func())
+
 func main() {
+	publish := flag.String("publish-factory", "", "publish an EthDuckFactory with this private key, print its address and exit")
+	flag.StringVar(&factoryAddr, "factory", "", "address of the EthDuckFactory to create games through, and to rebuild the lobby from; needs -rpc")
+	flag.StringVar(&rpcURL, "rpc", "", "Ethereum JSON-RPC endpoint to fetch contract logs from, for game timelines and the addresses of games made through -factory")
+	network := flag.String("network", "main", "Ethereum network to play on: main, or test for BlockCypher's testnet")
+	apiURL := flag.String("api", bcyeth.DefaultBaseURL, "BlockCypher API base URL, to use a mirror")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long to wait on each BlockCypher request")
+	retries := flag.Int("retries", 3, "how many times to retry BlockCypher requests that failed or were rate limited, when they're safe to repeat")
+	limits := flag.String("limits", "3/s,200/h", "BlockCypher request limits of the token's plan, like 3/s,200/h; empty for none")
+	pageTimeout := flag.Duration("page-timeout", time.Minute, "how long to spend on each page; a page that'd have to wait longer to stay under -limits fails with a 503 instead")
+	flag.StringVar(&hooksURL, "hooks", "", "public URL of this server, like https://ethduck.example.com, for BlockCypher webhooks that tell it when to refresh cached games; empty fetches games for every page")
+	streamEvents := flag.Bool("stream", false, "follow games over BlockCypher's WebSocket event stream, caching their state between transactions like -hooks, but without needing a public URL")
+	fake := new(bool)
+	if startFake != nil {
+		flag.BoolVar(fake, "fake", false, "play against an in-memory fake of BlockCypher instead of Ethereum, to try ethduck offline")
+	}
+	flag.Parse()
+	if factoryAddr != "" && rpcURL == "" {
+		log.Fatal("-factory needs -rpc, to read each new game's address from the factory's GameCreated event")
+	}
+	switch *network {
+	case "main":
+		bcy = bcyeth.NewMain(bcytoken.Token)
+	case "test":
+		bcy = bcyeth.NewTest(bcytoken.Token)
+	default:
+		log.Fatal("unknown network " + *network + ", use main or test")
+	}
+	bcy.BaseURL = *apiURL
+	if *fake {
+		api, stop := startFake()
+		defer stop()
+		bcy = api
+	}
+	bcy.Client = &http.Client{Timeout: *timeout}
+	if *retries > 0 {
+		retry := *bcyeth.DefaultRetry
+		retry.MaxRetries = *retries
+		bcy.Retry = &retry
+	}
+	//the fake has no limits to stay under
+	if !*fake {
+		limiters, err := bcyeth.ParseLimits(*limits)
+		if err != nil {
+			log.Fatal(err)
+		}
+		bcy.Limiters = limiters
+	}
+	if *publish != "" {
+		addr, err := publishFactory(context.Background(), *publish)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(addr)
+		return
+	}
+	if *streamEvents {
+		stream = bcy.NewStream(context.Background())
+		stream.OnReconnect(streamReconnected)
+	} else if hooksURL != "" {
+		if err := initHooks(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if factoryAddr != "" {
+		if err := syncLobby(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/games/", gameHandler)
+	http.HandleFunc("/created/", createdHandler)
+	http.HandleFunc("/timeline/", timelineHandler)
 	http.HandleFunc("/new/", newGameHandler)
+	http.HandleFunc("/practice/", practiceHandler)
 	http.HandleFunc("/confirm/", confirmGameHandler)
+	http.HandleFunc("/refund/", refundGameHandler)
+	http.HandleFunc("/raise/", raiseStakesHandler)
 	http.HandleFunc("/propose/win/", proposeWinHandler)
 	http.HandleFunc("/propose/draw/", proposeDrawHandler)
 	http.HandleFunc("/auth/move/", authorizeMoveHandler)
 	http.HandleFunc("/auth/win/", authorizeWinHandler)
 	http.HandleFunc("/auth/draw/", authorizeDrawHandler)
-	http.ListenAndServe(":80", nil)
+	http.HandleFunc("/channel/open/", openChannelHandler)
+	http.HandleFunc("/channel/move/", channelMoveHandler)
+	http.HandleFunc("/channel/propose/", channelProposeHandler)
+	http.HandleFunc("/channel/auth/", channelAuthHandler)
+	http.HandleFunc("/channel/submit/", channelSubmitHandler)
+	http.HandleFunc("/channel/finalize/", channelFinalizeHandler)
+	http.HandleFunc("/nigiri/reveal/", revealNigiriHandler)
+	http.HandleFunc("/nigiri/claim/", claimNigiriHandler)
+	http.HandleFunc("/market/new/", newMarketHandler)
+	http.HandleFunc("/market/back/", backMarketHandler)
+	http.HandleFunc("/market/claim/", claimMarketHandler)
+	http.HandleFunc("/hooks/", hookHandler)
+	http.ListenAndServe(":80", withTimeout(http.DefaultServeMux, *pageTimeout))
+}
+
+//withTimeout gives every request a deadline, so handlers don't wait
+//on BlockCypher (or the limiters) indefinitely
+func withTimeout(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+//serveError answers a request that failed with err, passing on what went wrong
+//with BlockCypher: rate limiting is a 503 with its Retry-After, a contract or
+//address it can't find is a 404, a call it rejected (like one that throws) is
+//a 400, and anything else from it is a 502; timeouts are a 504
+func serveError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *bcyeth.APIError
+	fromAPI := errors.As(err, &apiErr)
+	switch {
+	case bcyeth.IsRateLimited(err):
+		status = http.StatusServiceUnavailable
+		if apiErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+		}
+	case bcyeth.IsNotFound(err):
+		status = http.StatusNotFound
+	case fromAPI && apiErr.StatusCode == http.StatusBadRequest, err == errOlderVersion:
+		status = http.StatusBadRequest
+	case fromAPI:
+		status = http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), status)
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	err := templates.ExecuteTemplate(w, "index.html", "")
+	if factoryAddr != "" {
+		//the lobby still shows the games it knows
+		if err := syncLobby(r.Context()); err != nil {
+			log.Printf("syncing lobby with factory %s: %v", factoryAddr, err)
+		}
+	}
+	games, err := lobbyGames(r.Context())
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	var challenges []LobbyGame
+	for _, g := range games {
+		if g.Open && !g.Confirmed && !g.Unchecked {
+			challenges = append(challenges, g)
+		}
+	}
+	data := struct {
+		Challenges []LobbyGame
+		Games      []LobbyGame
+		Practice   bool
+	}{
+		challenges,
+		games,
+		bcy.Coin == "beth",
+	}
+	err = templates.ExecuteTemplate(w, "index.html", data)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err)
 		return
 	}
 }
@@ -64,20 +263,54 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
 	//Initialize Board
 	size, err := strconv.Atoi(f("size"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err)
 		return
 	}
 	wager := new(big.Int)
 	wager.SetString(f("wager"), 10)
 	blackPriv := f("blackPriv")
 	whiteAddr := f("whiteAddr")
-	//Generate New EthDuck Contract on Ethereum
-	contractAddr, err := publishEthDuck(blackPriv, whiteAddr, size, *wager)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	open := whiteAddr == ""
+	if open {
+		whiteAddr = openWhite
+	}
+	winnerShare, err := strconv.Atoi(f("winnerShare"))
+	if err != nil || winnerShare < 50 || winnerShare > 100 {
+		http.Error(w, "Winner's share must be a percent from 50 to 100", http.StatusBadRequest)
 		return
 	}
-	fmt.Fprintf(w, "Your contract address is %s , please wait for it to confirm before playing", contractAddr)
+	sideBets, _ := strconv.ParseBool(f("sideBets"))
+	nigiri, _ := strconv.ParseBool(f("nigiri"))
+	secret, commit := noNigiri, noNigiri
+	if nigiri {
+		secret, commit, err = newNigiriSecret()
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+	//Generate New EthDuck Contract on Ethereum, or clone one through the factory
+	if factoryAddr != "" {
+		var txHash string
+		txHash, err = newFactoryGame(r.Context(), blackPriv, whiteAddr, size, *wager, winnerShare, sideBets, commit, open)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		fmt.Fprintf(w, "Your game is being created in transaction %s , please wait for it to confirm before playing: follow it at /created/%s", txHash, txHash)
+	} else {
+		var contractAddr string
+		contractAddr, err = publishEthDuck(r.Context(), blackPriv, whiteAddr, size, *wager, winnerShare, sideBets, commit)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		addLobbyGame(contractAddr, wager, open)
+		fmt.Fprintf(w, "Your contract address is %s , please wait for it to confirm before playing: follow it at /games/%s", contractAddr, contractAddr)
+	}
+	if nigiri {
+		fmt.Fprintf(w, "\n\nYour nigiri secret is %s , keep it safe! Once white confirms, you reveal it on the game page to decide colors.", secret)
+	}
 	return
 }
 
@@ -91,32 +324,56 @@ func confirmGameHandler(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
-		addr, err := bcy.GetAddrBal(contractAddr)
+		addr, err := bcy.GetAddrBalContext(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		nigiri, err := getNigiri(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
-		err = confirmNewGame(contractAddr, private, addr.Balance)
+		secret, commit := noNigiri, noNigiri
+		if nigiri {
+			secret, commit, err = newNigiriSecret()
+			if err != nil {
+				serveError(w, err)
+				return
+			}
+		}
+		err = confirmNewGame(r.Context(), contractAddr, private, addr.Balance, commit)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
+			return
+		}
+		if nigiri {
+			fmt.Fprintf(w, "Game confirmed! Your nigiri secret is %s , keep it safe! Reveal it on the game page, /games/%s , to decide colors.", secret, contractAddr)
 			return
 		}
 		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 		return
 	} else {
-		confirmed, err := getConfirmed(contractAddr)
+		confirmed, err := getConfirmed(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		addr, err := bcy.GetAddrBalContext(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
-		addr, err := bcy.GetAddrBal(contractAddr)
+		white, err := getWhite(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		var message string
 		if confirmed {
 			message = "This game is already confirmed, you don't need to send money to this contract."
+		} else if white == openWhite {
+			message = "This is an open challenge! Accept it to play white: match the wei-ger of " + addr.Balance.String() + " by entering your private key."
 		} else {
 			message = "You need to confirm your game. Please enter your private key. The wei-ger is " + addr.Balance.String() + "."
 		}
@@ -129,7 +386,110 @@ func confirmGameHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		err = templates.ExecuteTemplate(w, "authorize.html", data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+func refundGameHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/refund/"):]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		err := refundGame(r.Context(), contractAddr, private)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	} else {
+		confirmed, err := getConfirmed(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if confirmed {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		addr, err := bcy.GetAddrBalContext(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		message := "White never confirmed this game. Black stone player can refund the wei-ger of " + addr.Balance.String() + " by entering their private key."
+		data := struct {
+			Message string
+			Post    string
+		}{
+			message,
+			"/refund/" + contractAddr,
+		}
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+func raiseStakesHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/raise/"):]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		value, ok := new(big.Int).SetString(f("value"), 10)
+		if !ok || value.Sign() <= 0 {
+			http.Error(w, "Wei to add must be a positive number", http.StatusBadRequest)
+			return
+		}
+		err := raiseStakes(r.Context(), contractAddr, private, *value)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	} else {
+		addr, err := bcy.GetAddrBalContext(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		sideBetPot, err := getSideBetPot(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		winnerShare, err := getWinnerShare(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		winner, loser := payouts(&addr.Balance, sideBetPot, winnerShare)
+		data := struct {
+			Pot          *big.Int
+			WinnerPayout *big.Int
+			LoserPayout  *big.Int
+			Post         string
+		}{
+			&addr.Balance,
+			winner,
+			loser,
+			"/raise/" + contractAddr,
+		}
+		err = templates.ExecuteTemplate(w, "raise.html", data)
+		if err != nil {
+			serveError(w, err)
 			return
 		}
 		return
@@ -138,69 +498,150 @@ func confirmGameHandler(w http.ResponseWriter, r *http.Request) {
 
 func gameHandler(w http.ResponseWriter, r *http.Request) {
 	contractAddr := r.URL.Path[len("/games/"):]
-	gameBoard, err := remakeGame(contractAddr)
+	waiting := pendingTXs(contractAddr)
+	if len(waiting) > 0 {
+		//reload until everything's mined
+		w.Header().Set("Refresh", "15")
+	}
+	gameBoard, err := loadGame(r.Context(), contractAddr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		//a game still being published isn't on the chain yet
+		if len(waiting) > 0 && waiting[0].Action == pendingActions["publish"] {
+			fmt.Fprintf(w, "Game published in transaction %s , waiting for it to be mined. This page reloads until then.", waiting[0].Hash)
+			return
+		}
+		serveError(w, err)
 		return
 	}
 	if r.Method == "POST" {
+		//clicking a point while the opponent's move waits for approval does both,
+		//on versions that have authorizeAndPropose
+		if gameBoard.ProposedMove != "" && gameBoard.Version > 1 {
+			authorizeAndProposeHandler(w, r, gameBoard)
+			return
+		}
 		moveHandler(w, r, gameBoard)
 		return
 	}
+	market, err := getMarketInfo(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	//in state channel mode, the board comes from the off-chain move chain
+	channel, channelOffer, deadline, err := channelGame(r.Context(), &gameBoard)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	history, historyNext, err := gameHistory(r.Context(), contractAddr, r.FormValue("before"), r.FormValue("seen"))
+	if err != nil {
+		serveError(w, err)
+		return
+	}
 	type gameTemp struct {
 		Game
-		PrettySVG string
+		PrettySVG       string
+		Market          *MarketInfo
+		Timeline        bool
+		Channel         *Channel
+		ChannelOffer    *Channel
+		DisputeDeadline int
+		ApproveAndPlay  bool
+		History         []GameTX
+		HistoryNext     string
+		Waiting         []PendingTX
 	}
-	necessary := gameTemp{gameBoard, gameBoard.State.PrettySVG()}
+	approveAndPlay := gameBoard.ProposedMove != "" && channel == nil && gameBoard.Version > 1
+	necessary := gameTemp{gameBoard, gameBoard.State.PrettySVG(), market, rpcURL != "", channel, channelOffer, deadline, approveAndPlay, history, historyNext, waiting}
 	err = templates.ExecuteTemplate(w, "game.html", necessary)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err)
 		return
 	}
 }
 
-func remakeGame(contractAddr string) (game Game, err error) {
+func remakeGame(ctx context.Context, contractAddr string) (game Game, err error) {
 	game.ContractAddr = contractAddr
-	game.Confirmed, err = getConfirmed(contractAddr)
+	game.Version, err = getVersion(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	game.Confirmed, err = getConfirmed(ctx, contractAddr)
 	if err != nil {
 		return
 	}
-	game.BlackTurn, err = getBlackTurn(contractAddr)
+	game.BlackTurn, err = getBlackTurn(ctx, contractAddr)
 	if err != nil {
 		return
 	}
-	game.ApprovalLock, err = getApprovalLock(contractAddr)
+	game.ApprovalLock, err = getApprovalLock(ctx, contractAddr)
 	if err != nil {
 		return
 	}
-	game.Draw, err = getDraw(contractAddr)
+	game.Draw, err = getDraw(ctx, contractAddr)
 	if err != nil {
 		return
 	}
-	game.Winner, err = getWinner(contractAddr)
+	game.Winner, err = getWinner(ctx, contractAddr)
 	if err != nil {
 		return
 	}
+	game.SideBets, err = getSideBets(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	game.Nigiri, err = getNigiri(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	if game.Nigiri {
+		game.BlackRevealed, game.WhiteRevealed, err = getRevealed(ctx, contractAddr)
+		if err != nil {
+			return
+		}
+	}
 	if game.ApprovalLock && !game.Draw && game.Winner == 0 {
-		x, y, color := getProposedMove(contractAddr)
+		x, y, color := getProposedMove(ctx, contractAddr)
 		if color == 1 {
 			game.ProposedMove = "black-"
 		} else {
 			game.ProposedMove = "white-"
 		}
 		game.ProposedMove += strconv.Itoa(x) + "-" + strconv.Itoa(y)
+		if game.SideBets {
+			game.ProposedStake, err = getProposedStake(ctx, contractAddr)
+			if err != nil {
+				return
+			}
+		}
 	}
-	size, err := getSize(contractAddr)
+	addr, err := bcy.GetAddrBalContext(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	game.Pot = &addr.Balance
+	game.SideBetPot, err = getSideBetPot(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	game.WinnerShare, err = getWinnerShare(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	game.WinnerPayout, game.LoserPayout = payouts(game.Pot, game.SideBetPot, game.WinnerShare)
+	size, err := getSize(ctx, contractAddr)
 	if err != nil {
 		return
 	}
 	game.State.Init(size)
-	numMoves, err := getNumMoves(contractAddr)
+	numMoves, err := getNumMoves(ctx, contractAddr)
 	if err != nil {
 		return
 	}
+	game.NumMoves = numMoves
 	for move := 0; move < numMoves; move++ {
-		x, y, color := getMove(contractAddr, move)
+		x, y, color := getMove(ctx, contractAddr, move)
 		if color == 1 {
 			err = game.State.SetB(x, y)
 		} else if color == 2 {
@@ -209,11 +650,37 @@ func remakeGame(contractAddr string) (game Game, err error) {
 		if err != nil {
 			return
 		}
+		if game.SideBets {
+			var stake *big.Int
+			stake, err = getStake(ctx, contractAddr, move)
+			if err != nil {
+				return
+			}
+			if stake.Sign() > 0 {
+				c := "black"
+				if color == 2 {
+					c = "white"
+				}
+				game.Stakes = append(game.Stakes, Stake{move + 1, c, x, y, stake})
+			}
+		}
 	}
 	game.BlackScore, game.WhiteScore = game.State.Score()
 	return
 }
 
+//payouts splits the pot like authorizeWinner does:
+//winner gets winnerShare percent of the pot minus side bets
+//plus all of the side bets, loser gets the rest
+func payouts(pot *big.Int, sideBetPot *big.Int, winnerShare int) (winner, loser *big.Int) {
+	winner = new(big.Int).Sub(pot, sideBetPot)
+	winner.Mul(winner, big.NewInt(int64(winnerShare)))
+	winner.Div(winner, big.NewInt(100))
+	winner.Add(winner, sideBetPot)
+	loser = new(big.Int).Sub(pot, winner)
+	return
+}
+
 func moveHandler(w http.ResponseWriter, r *http.Request, gameBoard Game) {
 	//Get move, send transaction
 	f := r.FormValue
@@ -229,9 +696,58 @@ func moveHandler(w http.ResponseWriter, r *http.Request, gameBoard Game) {
 	}
 	x, _ := strconv.Atoi(rawmove[1])
 	y, _ := strconv.Atoi(rawmove[2])
-	err := proposeMove(gameBoard.ContractAddr, private, x, y)
+	stake := new(big.Int)
+	if gameBoard.SideBets && f("stake") != "" {
+		if _, ok := stake.SetString(f("stake"), 10); !ok || stake.Sign() < 0 {
+			http.Error(w, "Side bet must be a number of wei", http.StatusBadRequest)
+			return
+		}
+	}
+	err := proposeMove(r.Context(), gameBoard.ContractAddr, private, x, y, *stake)
+	if err != nil {
+		serveError(w, err)
+	}
+	http.Redirect(w, r, "/games/"+gameBoard.ContractAddr, http.StatusFound)
+	return
+}
+
+func authorizeAndProposeHandler(w http.ResponseWriter, r *http.Request, gameBoard Game) {
+	//Approve proposed move, get move, send transaction
+	f := r.FormValue
+	rawmove := strings.Split(f("orig-message"), "-")
+	private := f("private")
+	if len(rawmove) != 3 {
+		serveError(w, errors.New("Bad move"))
+		return
+	}
+	//the approver is whoever didn't propose, so it's the other color's turn next
+	if gameBoard.BlackTurn && rawmove[0] != "white" {
+		http.Error(w, "White needs to approve black's move", http.StatusInternalServerError)
+		return
+	}
+	if !gameBoard.BlackTurn && rawmove[0] != "black" {
+		http.Error(w, "Black needs to approve white's move", http.StatusInternalServerError)
+		return
+	}
+	x, _ := strconv.Atoi(rawmove[1])
+	y, _ := strconv.Atoi(rawmove[2])
+	//value matches the proposed move's side bet, plus this move's own
+	value := new(big.Int)
+	if gameBoard.ProposedStake != nil {
+		value.Set(gameBoard.ProposedStake)
+	}
+	if gameBoard.SideBets && f("stake") != "" {
+		stake, ok := new(big.Int).SetString(f("stake"), 10)
+		if !ok || stake.Sign() < 0 {
+			http.Error(w, "Side bet must be a number of wei", http.StatusBadRequest)
+			return
+		}
+		value.Add(value, stake)
+	}
+	err := authorizeAndPropose(r.Context(), gameBoard.ContractAddr, private, x, y, *value)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err)
+		return
 	}
 	http.Redirect(w, r, "/games/"+gameBoard.ContractAddr, http.StatusFound)
 	return
@@ -247,17 +763,17 @@ func proposeWinHandler(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 			return
 		}
-		err := proposeWinner(contractAddr, private)
+		err := proposeWinner(r.Context(), contractAddr, private)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 		return
 	} else {
-		winner, err := getWinner(contractAddr)
+		winner, err := getWinner(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		var message string
@@ -277,7 +793,7 @@ func proposeWinHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		err = templates.ExecuteTemplate(w, "authorize.html", data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		return
@@ -294,17 +810,17 @@ func proposeDrawHandler(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 			return
 		}
-		err := proposeDraw(contractAddr, private)
+		err := proposeDraw(r.Context(), contractAddr, private)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 		return
 	} else {
-		draw, err := getDraw(contractAddr)
+		draw, err := getDraw(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		var message string
@@ -322,7 +838,7 @@ func proposeDrawHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		err = templates.ExecuteTemplate(w, "authorize.html", data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		return
@@ -335,21 +851,39 @@ func authorizeMoveHandler(w http.ResponseWriter, r *http.Request) {
 		f := r.FormValue
 		private := f("private")
 		approve, _ := strconv.ParseBool(f("approve"))
-		err := authorizeMove(contractAddr, private, approve)
+		//approving has to match the proposed side bet, if any
+		stake := new(big.Int)
+		if approve {
+			var err error
+			stake, err = getProposedStake(r.Context(), contractAddr)
+			if err != nil {
+				serveError(w, err)
+				return
+			}
+		}
+		err := authorizeMove(r.Context(), contractAddr, private, approve, *stake)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 	} else {
 		var message string
-		x, y, color := getProposedMove(contractAddr)
+		x, y, color := getProposedMove(r.Context(), contractAddr)
 		if color == 1 {
 			message = "Black "
 		} else {
 			message = "White "
 		}
 		message += "wants to move on " + strconv.Itoa(x) + ", " + strconv.Itoa(y) + "."
+		stake, err := getProposedStake(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if stake.Sign() > 0 {
+			message += " They bet " + stake.String() + " wei on it; approving matches their bet."
+		}
 		data := struct {
 			Message string
 			Post    string
@@ -357,9 +891,9 @@ func authorizeMoveHandler(w http.ResponseWriter, r *http.Request) {
 			message,
 			"/auth/move/" + contractAddr,
 		}
-		err := templates.ExecuteTemplate(w, "authorize.html", data)
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		return
@@ -372,17 +906,17 @@ func authorizeWinHandler(w http.ResponseWriter, r *http.Request) {
 		f := r.FormValue
 		private := f("private")
 		approve, _ := strconv.ParseBool(f("approve"))
-		err := authorizeWinner(contractAddr, private, approve)
+		err := authorizeWinner(r.Context(), contractAddr, private, approve)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 		return
 	} else {
-		winner, err := getWinner(contractAddr)
+		winner, err := getWinner(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		var message string
@@ -402,7 +936,7 @@ func authorizeWinHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		err = templates.ExecuteTemplate(w, "authorize.html", data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		return
@@ -415,17 +949,17 @@ func authorizeDrawHandler(w http.ResponseWriter, r *http.Request) {
 		f := r.FormValue
 		private := f("private")
 		approve, _ := strconv.ParseBool(f("approve"))
-		err := authorizeDraw(contractAddr, private, approve)
+		err := authorizeDraw(r.Context(), contractAddr, private, approve)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
 		return
 	} else {
-		draw, err := getDraw(contractAddr)
+		draw, err := getDraw(r.Context(), contractAddr)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		var message string
@@ -443,86 +977,214 @@ func authorizeDrawHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		err = templates.ExecuteTemplate(w, "authorize.html", data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 		return
 	}
 }
 
+//lobby helpers
+func addLobbyGame(contractAddr string, wager *big.Int, open bool) {
+	listLobbyGame(LobbyGame{ContractAddr: contractAddr, Created: time.Now(), Wager: wager, Open: open})
+}
+
+//listLobbyGame adds a game to the lobby, unless the
+//factory's registry has turned it up already
+func listLobbyGame(game LobbyGame) {
+	lobby.Lock()
+	defer lobby.Unlock()
+	for _, g := range lobby.games {
+		if g.ContractAddr == game.ContractAddr {
+			return
+		}
+	}
+	lobby.games = append(lobby.games, game)
+}
+
+func removeLobbyGame(contractAddr string) {
+	lobby.Lock()
+	defer lobby.Unlock()
+	for i, g := range lobby.games {
+		if g.ContractAddr == contractAddr {
+			lobby.games = append(lobby.games[:i], lobby.games[i+1:]...)
+			return
+		}
+	}
+}
+
+//lobbyGames checks the contracts of unconfirmed games, and marks
+//those that white hasn't confirmed after refundAfter as refundable;
+//games that can't be checked are marked Unchecked, not left out
+func lobbyGames(ctx context.Context) (games []LobbyGame, err error) {
+	//the lobby isn't held while BlockCypher is asked, so
+	//a slow request doesn't hold up every other reader
+	lobby.Lock()
+	games = append(games, lobby.games...)
+	lobby.Unlock()
+	for i := range games {
+		g := &games[i]
+		if !g.Confirmed {
+			confirmed, checkErr := getConfirmed(ctx, g.ContractAddr)
+			if checkErr != nil {
+				log.Printf("checking lobby game %s: %v", g.ContractAddr, checkErr)
+				g.Unchecked = true
+				continue
+			}
+			if confirmed {
+				g.Confirmed = true
+				confirmLobbyGame(g.ContractAddr)
+			}
+		}
+		g.Refundable = !g.Confirmed && time.Since(g.Created) > refundAfter
+	}
+	return
+}
+
+//confirmLobbyGame remembers white confirmed a game, so it isn't checked again
+func confirmLobbyGame(contractAddr string) {
+	lobby.Lock()
+	defer lobby.Unlock()
+	for i := range lobby.games {
+		if lobby.games[i].ContractAddr == contractAddr {
+			lobby.games[i].Confirmed = true
+			return
+		}
+	}
+}
+
 //contract helpers
-func publishEthDuck(blackPriv string, whiteAddr string, size int, wager big.Int) (contractAddr string, err error) {
+func publishEthDuck(ctx context.Context, blackPriv string, whiteAddr string, size int, wager big.Int, winnerShare int, sideBets bool, commit string) (contractAddr string, err error) {
 	contract := bcyeth.Contract{
 		Private:  blackPriv,
-		Solidity: importSol(),
-		Publish:  []string{"EthDuck"},
-		Params:   []interface{}{size, whiteAddr},
+		Bin:      contracts["EthDuck"].Bin,
+		ABI:      contracts["EthDuck"].ABI,
+		Params:   []interface{}{size, whiteAddr, winnerShare, sideBets, commit},
 		Value:    wager,
-		GasLimit: 1400000,
+		GasLimit: 3000000,
 	}
-	result, err := bcy.CreateContract(contract)
+	result, err := bcy.CreateContractContext(ctx, contract)
 	if err != nil {
 		return
 	}
 	contractAddr = result[0].Address
+	trackTX(contractAddr, "publish", result[0].TXHash())
 	return
 }
 
-func importSol() (sol string) {
-	file, err := os.Open("./ethduck.sol")
+//confirm game, add wager
+func confirmNewGame(ctx context.Context, contractAddr string, private string, value big.Int, commit string) (err error) {
+	version, err := getVersion(ctx, contractAddr)
 	if err != nil {
-		panic(err)
+		return
 	}
-	defer file.Close()
-	//convert solidity to string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		sol += strings.Replace(scanner.Text(), "\t", " ", -1) + "\n"
+	//accepting an open challenge on a factory game also registers white with the factory
+	contract := bcyeth.Contract{Private: private, Params: []interface{}{commit}, GasLimit: 200000, Value: value}
+	//version 1 has no nigiri commit
+	if version == 1 {
+		contract.Params = nil
 	}
-	sol = strings.TrimSpace(sol)
+	_, err = callEthDuck(ctx, contract, contractAddr, "confirmNewGame")
 	return
 }
 
-//confirm game, add wager
-func confirmNewGame(contractAddr string, private string, value big.Int) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, GasLimit: 100000, Value: value}, contractAddr, "confirmNewGame")
+//refund unconfirmed game, self-destructs contract; the contract silently
+//ignores anyone but black, or a confirmed game, so those are caught first
+func refundGame(ctx context.Context, contractAddr string, private string) (err error) {
+	sender, err := bcyeth.PrivToAddr(private)
+	if err != nil {
+		return
+	}
+	black, err := getBlack(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	if !strings.EqualFold(sender, black) {
+		err = errors.New("Only the black stone player can refund this game")
+		return
+	}
+	confirmed, err := getConfirmed(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	if confirmed {
+		err = errors.New("White already confirmed this game, so it can't be refunded")
+		return
+	}
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: private, GasLimit: 100000}, contractAddr, "refundGame")
+	if err != nil {
+		return
+	}
+	go refunded(contractAddr, result.TXHash())
+	return
+}
+
+//refunded takes a game out of the lobby once its refund is mined, and the
+//contract is gone
+func refunded(contractAddr string, hash string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pendingTimeout)
+	defer cancel()
+	if _, err := bcy.WaitForConfirmationsContext(ctx, hash, 1); err != nil {
+		log.Printf("gave up waiting on refund %s for %s: %v", hash, contractAddr, err)
+		return
+	}
+	_, err := bcy.GetContractContext(ctx, contractAddr)
+	if !bcyeth.IsNotFound(err) {
+		log.Printf("refund %s for %s was mined, but the game is still there: %v", hash, contractAddr, err)
+		return
+	}
+	removeLobbyGame(contractAddr)
+}
+
+//add to the pot through the contract's payable fallback function
+func raiseStakes(ctx context.Context, contractAddr string, private string, value big.Int) (err error) {
+	hash, err := bcy.SendValueContext(ctx, private, contractAddr, value, 50000)
+	if err != nil {
+		return
+	}
+	trackTX(contractAddr, "raiseStakes", hash)
 	return
 }
 
 //make moves
-func proposeMove(contractAddr string, private string, x int, y int) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, Params: []interface{}{x, y}, GasLimit: 100000}, contractAddr, "proposeMove")
+func proposeMove(ctx context.Context, contractAddr string, private string, x int, y int, stake big.Int) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{x, y}, GasLimit: 100000, Value: stake}, contractAddr, "proposeMove")
 	return
 }
 
-func authorizeMove(contractAddr string, private string, approve bool) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, Params: []interface{}{approve}, GasLimit: 200000}, contractAddr, "authorizeMove")
+func authorizeMove(ctx context.Context, contractAddr string, private string, approve bool, stake big.Int) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{approve}, GasLimit: 200000, Value: stake}, contractAddr, "authorizeMove")
 	return
 }
 
-func proposeDraw(contractAddr string, private string) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, GasLimit: 100000}, contractAddr, "proposeDraw")
+func authorizeAndPropose(ctx context.Context, contractAddr string, private string, x int, y int, value big.Int) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{x, y}, GasLimit: 300000, Value: value}, contractAddr, "authorizeAndPropose")
 	return
 }
 
-func authorizeDraw(contractAddr string, private string, approve bool) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, Params: []interface{}{approve}, GasLimit: 200000}, contractAddr, "authorizeDraw")
+func proposeDraw(ctx context.Context, contractAddr string, private string) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, GasLimit: 100000}, contractAddr, "proposeDraw")
 	return
 }
 
-func proposeWinner(contractAddr string, private string) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, GasLimit: 100000}, contractAddr, "proposeWinner")
+func authorizeDraw(ctx context.Context, contractAddr string, private string, approve bool) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{approve}, GasLimit: 200000}, contractAddr, "authorizeDraw")
 	return
 }
 
-func authorizeWinner(contractAddr string, private string, approve bool) (err error) {
-	_, err = bcy.CallContract(bcyeth.Contract{Private: private, Params: []interface{}{approve}, GasLimit: 200000}, contractAddr, "authorizeWinner")
+func proposeWinner(ctx context.Context, contractAddr string, private string) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, GasLimit: 100000}, contractAddr, "proposeWinner")
+	return
+}
+
+func authorizeWinner(ctx context.Context, contractAddr string, private string, approve bool) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{approve}, GasLimit: 200000}, contractAddr, "authorizeWinner")
 	return
 }
 
 //constant contract methods
-func getConfirmed(contractAddr string) (confirmed bool, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "confirmed")
+func getConfirmed(ctx context.Context, contractAddr string) (confirmed bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "confirmed")
 	if err != nil {
 		return
 	}
@@ -530,8 +1192,26 @@ func getConfirmed(contractAddr string) (confirmed bool, err error) {
 	return
 }
 
-func getBlackTurn(contractAddr string) (blackTurn bool, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "blackTurn")
+func getBlack(ctx context.Context, contractAddr string) (black string, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "black")
+	if err != nil {
+		return
+	}
+	black = strings.TrimPrefix(result.Results[0].(string), "0x")
+	return
+}
+
+func getWhite(ctx context.Context, contractAddr string) (white string, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "white")
+	if err != nil {
+		return
+	}
+	white = strings.TrimPrefix(result.Results[0].(string), "0x")
+	return
+}
+
+func getBlackTurn(ctx context.Context, contractAddr string) (blackTurn bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "blackTurn")
 	if err != nil {
 		return
 	}
@@ -539,8 +1219,8 @@ func getBlackTurn(contractAddr string) (blackTurn bool, err error) {
 	return
 }
 
-func getApprovalLock(contractAddr string) (approvalLock bool, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "approvalLock")
+func getApprovalLock(ctx context.Context, contractAddr string) (approvalLock bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "approvalLock")
 	if err != nil {
 		return
 	}
@@ -548,8 +1228,8 @@ func getApprovalLock(contractAddr string) (approvalLock bool, err error) {
 	return
 }
 
-func getWinner(contractAddr string) (winner int, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "winner")
+func getWinner(ctx context.Context, contractAddr string) (winner int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "winner")
 	if err != nil {
 		return
 	}
@@ -561,8 +1241,8 @@ func getWinner(contractAddr string) (winner int, err error) {
 	return
 }
 
-func getDraw(contractAddr string) (draw bool, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "draw")
+func getDraw(ctx context.Context, contractAddr string) (draw bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "draw")
 	if err != nil {
 		return
 	}
@@ -570,8 +1250,8 @@ func getDraw(contractAddr string) (draw bool, err error) {
 	return
 }
 
-func getSize(contractAddr string) (size int, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "size")
+func getSize(ctx context.Context, contractAddr string) (size int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "size")
 	if err != nil {
 		return
 	}
@@ -583,8 +1263,8 @@ func getSize(contractAddr string) (size int, err error) {
 	return
 }
 
-func getNumMoves(contractAddr string) (numMoves int, err error) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "getNumMoves")
+func getNumMoves(ctx context.Context, contractAddr string) (numMoves int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "getNumMoves")
 	if err != nil {
 		return
 	}
@@ -596,8 +1276,8 @@ func getNumMoves(contractAddr string) (numMoves int, err error) {
 	return
 }
 
-func getMove(contractAddr string, move int) (x, y, color int) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", Params: []interface{}{move}}, contractAddr, "getMove")
+func getMove(ctx context.Context, contractAddr string, move int) (x, y, color int) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", Params: []interface{}{move}}, contractAddr, "getMove")
 	if err != nil {
 		return
 	}
@@ -617,8 +1297,8 @@ func getMove(contractAddr string, move int) (x, y, color int) {
 	return
 }
 
-func getProposedMove(contractAddr string) (x, y, color int) {
-	result, err := bcy.CallContract(bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "proposed")
+func getProposedMove(ctx context.Context, contractAddr string) (x, y, color int) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "proposed")
 	if err != nil {
 		return
 	}
@@ -637,3 +1317,83 @@ func getProposedMove(contractAddr string) (x, y, color int) {
 	x, y, color = int(xNum), int(yNum), int(colorNum)
 	return
 }
+
+func getWinnerShare(ctx context.Context, contractAddr string) (winnerShare int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "winnerShare")
+	//version 1 games always pay the winner 3/4 of the pot
+	if err == errOlderVersion {
+		winnerShare, err = 75, nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	num, err := result.Results[0].(json.Number).Int64()
+	if err != nil {
+		return
+	}
+	winnerShare = int(num)
+	return
+}
+
+func getSideBets(ctx context.Context, contractAddr string) (sideBets bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "sideBets")
+	//older versions don't have side bets
+	if err == errOlderVersion {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	sideBets = result.Results[0].(bool)
+	return
+}
+
+func getProposedStake(ctx context.Context, contractAddr string) (stake *big.Int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "proposedStake")
+	if err == errOlderVersion {
+		stake, err = new(big.Int), nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	stake, err = resultBigInt(result.Results[0])
+	return
+}
+
+func getSideBetPot(ctx context.Context, contractAddr string) (sideBetPot *big.Int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "sideBetPot")
+	if err == errOlderVersion {
+		sideBetPot, err = new(big.Int), nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	sideBetPot, err = resultBigInt(result.Results[0])
+	return
+}
+
+func getStake(ctx context.Context, contractAddr string, move int) (stake *big.Int, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", Params: []interface{}{move}}, contractAddr, "stakes")
+	if err == errOlderVersion {
+		stake, err = new(big.Int), nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	stake, err = resultBigInt(result.Results[0])
+	return
+}
+
+//resultBigInt converts a uint contract result (in wei) to a big.Int
+func resultBigInt(result interface{}) (num *big.Int, err error) {
+	num, ok := new(big.Int).SetString(string(result.(json.Number)), 10)
+	if !ok {
+		err = fmt.Errorf("%v is not an integer", result)
+	}
+	return
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+
+	"golang.org/x/crypto/sha3"
+)
+
+//commit for games without nigiri, where the creator is always black
+const noNigiri = "0000000000000000000000000000000000000000000000000000000000000000"
+
+//newNigiriSecret makes a random 32 byte secret for a player, and the
+//commit the contract stores, which is sha3 (keccak256) of the secret
+func newNigiriSecret() (secret string, commit string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return
+	}
+	h := sha3.NewLegacyKeccak256()
+	h.Write(raw)
+	secret, commit = hex.EncodeToString(raw), hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+//revealNigiriHandler reveals a player's secret, from the form on the game page
+func revealNigiriHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/nigiri/reveal/"):]
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	}
+	f := r.FormValue
+	private := f("private")
+	secret := f("secret")
+	if raw, err := hex.DecodeString(secret); err != nil || len(raw) != 32 {
+		http.Error(w, "Nigiri secret must be the 64 hex characters you were given", http.StatusBadRequest)
+		return
+	}
+	err := revealNigiri(r.Context(), contractAddr, private, secret)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+}
+
+//claimNigiriHandler lets the only player who revealed claim the game after the
+//deadline, as if their opponent conceded; the contract self-destructs
+func claimNigiriHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/nigiri/claim/"):]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		err := claimNigiri(r.Context(), contractAddr, private)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	} else {
+		blackRevealed, whiteRevealed, err := getRevealed(r.Context(), contractAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if blackRevealed == whiteRevealed {
+			http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+			return
+		}
+		message := "Your opponent didn't reveal their nigiri secret. If the reveal deadline has passed, they forfeit: you can claim the game, and the winner's share of the pot."
+		data := struct {
+			Message string
+			Post    string
+		}{
+			message,
+			"/nigiri/claim/" + contractAddr,
+		}
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//nigiri contract helpers
+func revealNigiri(ctx context.Context, contractAddr string, private string, secret string) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{secret}, GasLimit: 100000}, contractAddr, "reveal")
+	return
+}
+
+func claimNigiri(ctx context.Context, contractAddr string, private string) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, GasLimit: 200000}, contractAddr, "claimNigiri")
+	return
+}
+
+//constant nigiri methods
+func getNigiri(ctx context.Context, contractAddr string) (nigiri bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "nigiri")
+	//older versions don't have nigiri
+	if err == errOlderVersion {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	nigiri = result.Results[0].(bool)
+	return
+}
+
+func getRevealed(ctx context.Context, contractAddr string) (blackRevealed bool, whiteRevealed bool, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "blackRevealed")
+	if err != nil {
+		return
+	}
+	blackRevealed = result.Results[0].(bool)
+	result, err = callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "whiteRevealed")
+	if err != nil {
+		return
+	}
+	whiteRevealed = result.Results[0].(bool)
+	return
+}
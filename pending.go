@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+//PendingTX is a transaction sent for a game that isn't mined yet
+type PendingTX struct {
+	Action string
+	Hash   string
+	Sent   time.Time
+}
+
+//how long a pending transaction is watched before it's assumed lost
+const pendingTimeout = 30 * time.Minute
+
+//what each transaction does, for the game page
+var pendingActions = map[string]string{
+	"publish":             "Game published",
+	"confirmNewGame":      "Game confirmation submitted",
+	"refundGame":          "Refund submitted",
+	"raiseStakes":         "Raise submitted",
+	"proposeMove":         "Move submitted",
+	"authorizeMove":       "Move approval submitted",
+	"authorizeAndPropose": "Approval and move submitted",
+	"proposeWinner":       "Win proposal submitted",
+	"authorizeWinner":     "Win approval submitted",
+	"proposeDraw":         "Draw proposal submitted",
+	"authorizeDraw":       "Draw approval submitted",
+	"reveal":              "Nigiri secret submitted",
+	"claimNigiri":         "Nigiri forfeit claim submitted",
+	"setMarket":           "Spectator market submitted",
+	"openChannel":         "State channel opening submitted",
+	"submitState":         "Channel state submitted",
+	"answerDispute":       "Dispute move submitted",
+	"finalizeDispute":     "Channel settlement submitted",
+	"faucet":              "Faucet funding sent",
+}
+
+//transactions waiting for a block, by game address (or practice game ID
+//while it's being funded); like the lobby,
+//these are lost on restart, the transactions themselves are not
+var pending struct {
+	sync.Mutex
+	games map[string][]PendingTX
+}
+
+func init() {
+	pending.games = make(map[string][]PendingTX)
+}
+
+//trackTX lists a transaction on its game's page until it's mined; a game
+//watched by hooks or the event stream is told when that happens (see
+//gameChanged), otherwise the transaction is polled for
+func trackTX(contractAddr string, method string, hash string) {
+	if hash == "" {
+		return
+	}
+	contractAddr = listTX(contractAddr, method, hash)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pendingTimeout)
+		defer cancel()
+		if hooksURL != "" || stream != nil {
+			_, err := watchGame(ctx, contractAddr)
+			if err == nil {
+				<-ctx.Done()
+				untrackTX(contractAddr, hash)
+				return
+			}
+			log.Printf("watching %s for %s, polling instead: %v", contractAddr, hash, err)
+		}
+		if _, err := bcy.WaitForConfirmationsContext(ctx, hash, 1); err != nil {
+			log.Printf("gave up waiting on %s for %s: %v", hash, contractAddr, err)
+		}
+		untrackTX(contractAddr, hash)
+	}()
+}
+
+//listTX lists a transaction under key (a game address, or a practice game's ID)
+//without watching for it, for callers already waiting on it themselves, who
+//untrack it when they're done; it returns the key as it's listed
+func listTX(key string, method string, hash string) string {
+	key = strings.ToLower(strings.TrimPrefix(key, "0x"))
+	action, ok := pendingActions[method]
+	if !ok {
+		action = method + " submitted"
+	}
+	pending.Lock()
+	pending.games[key] = append(pending.games[key], PendingTX{action, hash, time.Now()})
+	pending.Unlock()
+	return key
+}
+
+func untrackTX(contractAddr string, hash string) {
+	contractAddr = strings.ToLower(strings.TrimPrefix(contractAddr, "0x"))
+	pending.Lock()
+	defer pending.Unlock()
+	txs := pending.games[contractAddr]
+	for i, tx := range txs {
+		if tx.Hash == hash {
+			txs = append(txs[:i:i], txs[i+1:]...)
+			break
+		}
+	}
+	if len(txs) == 0 {
+		delete(pending.games, contractAddr)
+		return
+	}
+	pending.games[contractAddr] = txs
+}
+
+//pendingTXs are a game's transactions waiting for a block, oldest first
+func pendingTXs(contractAddr string) (txs []PendingTX) {
+	contractAddr = strings.ToLower(strings.TrimPrefix(contractAddr, "0x"))
+	pending.Lock()
+	defer pending.Unlock()
+	txs = append(txs, pending.games[contractAddr]...)
+	return
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//practice games are played on the testnet, for free ether from its faucet:
+//each player gets practiceFunds, enough for the wager and gas
+var practiceFunds = new(big.Int).Exp(big.NewInt(10), big.NewInt(17), nil)
+var practiceWager = new(big.Int).Exp(big.NewInt(10), big.NewInt(15), nil)
+
+//how long the faucet's ether gets to arrive before a practice game gives up
+const practiceFundTimeout = 10 * time.Minute
+
+//Practice is a practice game being set up in the background, at /practice/{ID}
+type Practice struct {
+	ID           string
+	Black        bcyeth.AddrKeychain
+	White        bcyeth.AddrKeychain
+	Size         int
+	Started      time.Time
+	ContractAddr string
+	Err          error
+}
+
+//practice games being set up or set up, by ID; like the lobby, these
+//are lost on restart, but the keys are shown to the player from the start
+var practices struct {
+	sync.Mutex
+	games map[string]*Practice
+}
+
+func init() {
+	practices.games = make(map[string]*Practice)
+}
+
+//practiceHandler onboards new players: it makes them a keypair for each color,
+//asks the testnet faucet to fund both, and publishes a game between them once
+//the ether arrives; that takes a few minutes, so it's done in the background,
+//and the player is sent to /practice/{id} to watch
+func practiceHandler(w http.ResponseWriter, r *http.Request) {
+	if bcy.Coin != "beth" {
+		http.Error(w, "Practice games are played on the testnet, start the server with -network test", http.StatusNotFound)
+		return
+	}
+	type practiceTemp struct {
+		Practice *Practice
+		Waiting  []PendingTX
+		Wager    *big.Int
+	}
+	if r.Method == "POST" {
+		size, err := strconv.Atoi(r.FormValue("size"))
+		if err != nil || size < 4 || size > 19 {
+			http.Error(w, "Board size must be from 4 to 19", http.StatusBadRequest)
+			return
+		}
+		p, err := newPractice(r.Context(), size)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/practice/"+p.ID, http.StatusSeeOther)
+		return
+	} else {
+		data := practiceTemp{Wager: practiceWager}
+		if id := r.URL.Path[len("/practice/"):]; id != "" {
+			practices.Lock()
+			p, ok := practices.games[id]
+			if ok {
+				copied := *p
+				data.Practice = &copied
+			}
+			practices.Unlock()
+			if !ok {
+				http.Error(w, "No such practice game", http.StatusNotFound)
+				return
+			}
+			data.Waiting = pendingTXs(id)
+			if data.Practice.ContractAddr == "" && data.Practice.Err == nil {
+				//reload until the game's published
+				w.Header().Set("Refresh", "15")
+			}
+		}
+		err := templates.ExecuteTemplate(w, "practice.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//newPractice makes a keypair for each color and asks the faucet to fund them,
+//then waits for the ether and publishes their game in the background
+func newPractice(ctx context.Context, size int) (p *Practice, err error) {
+	raw := make([]byte, 16)
+	if _, err = rand.Read(raw); err != nil {
+		return
+	}
+	p = &Practice{ID: hex.EncodeToString(raw), Size: size, Started: time.Now()}
+	p.Black, err = bcy.GenAddrKeychainContext(ctx)
+	if err != nil {
+		return
+	}
+	p.White, err = bcy.GenAddrKeychainContext(ctx)
+	if err != nil {
+		return
+	}
+	var hashes []string
+	for _, player := range []bcyeth.AddrKeychain{p.Black, p.White} {
+		var hash string
+		hash, err = bcy.FaucetContext(ctx, player.Address, *practiceFunds)
+		if err != nil {
+			return
+		}
+		hashes = append(hashes, hash)
+	}
+	practices.Lock()
+	practices.games[p.ID] = p
+	practices.Unlock()
+	for _, hash := range hashes {
+		listTX(p.ID, "faucet", hash)
+	}
+	go setUpPractice(p, hashes)
+	return
+}
+
+//setUpPractice waits for the faucet's ether to reach both players,
+//then publishes their game
+func setUpPractice(p *Practice, hashes []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), practiceFundTimeout)
+	defer cancel()
+	contractAddr, err := fundPractice(ctx, p, hashes)
+	practices.Lock()
+	p.ContractAddr, p.Err = contractAddr, err
+	practices.Unlock()
+	if err != nil {
+		log.Printf("setting up practice game %s: %v", p.ID, err)
+		return
+	}
+	addLobbyGame(contractAddr, practiceWager, false)
+}
+
+func fundPractice(ctx context.Context, p *Practice, hashes []string) (contractAddr string, err error) {
+	for _, hash := range hashes {
+		_, err = bcy.WaitForConfirmationsContext(ctx, hash, 1)
+		untrackTX(p.ID, hash)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New("the faucet's ether didn't arrive in time, try again later")
+		}
+		if err != nil {
+			return
+		}
+	}
+	contractAddr, err = publishEthDuck(ctx, p.Black.Private, p.White.Address, p.Size, *practiceWager, 75, false, noNigiri)
+	return
+}
@@ -0,0 +1,97 @@
+//Command solcgen compiles ethduck's contracts with solc ahead of time, writing
+//each contract's bytecode and ABI to build/, along with the hashes of the
+//sources they were compiled from, so the server can tell if they're stale.
+//It's run by go generate from the repository root:
+//
+//	go generate
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//sources compiled, and the contracts published from them
+var sources = []string{"ethduck.sol", "factory.sol", "spectators.sol"}
+var published = []string{"EthDuck", "EthDuckFactory", "SpectatorMarket"}
+
+const outDir = "build"
+
+func main() {
+	if err := generate(); err != nil {
+		fmt.Fprintln(os.Stderr, "solcgen:", err)
+		os.Exit(1)
+	}
+}
+
+func generate() (err error) {
+	args := append([]string{"--optimize", "--combined-json", "abi,bin"}, sources...)
+	var stderr bytes.Buffer
+	cmd := exec.Command("solc", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("solc: %v\n%s", err, stderr.String())
+	}
+	var compiled struct {
+		Contracts map[string]struct {
+			ABI json.RawMessage `json:"abi"`
+			Bin string          `json:"bin"`
+		} `json:"contracts"`
+	}
+	if err = json.Unmarshal(out, &compiled); err != nil {
+		return
+	}
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		return
+	}
+	for _, name := range published {
+		found := false
+		for key, c := range compiled.Contracts {
+			//keys are "source.sol:Name"
+			if key[strings.LastIndex(key, ":")+1:] != name {
+				continue
+			}
+			if c.Bin == "" {
+				return fmt.Errorf("%s compiled to empty bytecode", name)
+			}
+			abi := c.ABI
+			//older solc gives the ABI as a JSON string
+			var s string
+			if json.Unmarshal(abi, &s) == nil {
+				abi = json.RawMessage(s)
+			}
+			if err = ioutil.WriteFile(filepath.Join(outDir, name+".bin"), []byte(c.Bin), 0644); err != nil {
+				return
+			}
+			if err = ioutil.WriteFile(filepath.Join(outDir, name+".abi"), abi, 0644); err != nil {
+				return
+			}
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("solc output has no %s contract", name)
+		}
+	}
+	//sha256sum format, one "hash  file" line per source
+	var sums bytes.Buffer
+	for _, src := range sources {
+		var raw []byte
+		raw, err = ioutil.ReadFile(src)
+		if err != nil {
+			return
+		}
+		sum := sha256.Sum256(raw)
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), src)
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, "sources.sha256"), sums.Bytes(), 0644)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//MarketInfo is the state of a game's spectator market, see spectators.sol
+type MarketInfo struct {
+	ContractAddr string
+	Cutoff       int
+	Open         bool
+	Settled      bool
+	RefundBlock  int
+	TotalBlack   *big.Int
+	TotalWhite   *big.Int
+}
+
+//how many blocks a game has to settle its market before backers
+//can void it and take their stakes back, about a month
+const marketTimeout = 175000
+
+//newMarketHandler publishes a spectator market for a game, then attaches it
+//to the game; only a player's private key can attach it
+func newMarketHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/market/new/"):]
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	}
+	f := r.FormValue
+	private := f("private")
+	cutoff, err := strconv.Atoi(f("cutoff"))
+	if err != nil || cutoff <= 0 {
+		http.Error(w, "Cutoff must be a positive number of moves", http.StatusBadRequest)
+		return
+	}
+	marketAddr, err := publishMarket(r.Context(), private, contractAddr, cutoff)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	err = setMarket(r.Context(), contractAddr, private, marketAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+}
+
+//backMarketHandler bets on black or white in a game's market
+func backMarketHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/market/back/"):]
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+		return
+	}
+	f := r.FormValue
+	private := f("private")
+	side := f("side")
+	if side != "black" && side != "white" {
+		http.Error(w, "Back either black or white", http.StatusBadRequest)
+		return
+	}
+	value, ok := new(big.Int).SetString(f("value"), 10)
+	if !ok || value.Sign() <= 0 {
+		http.Error(w, "Bet must be a positive number of wei", http.StatusBadRequest)
+		return
+	}
+	marketAddr, err := getMarket(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if marketAddr == "" {
+		http.Error(w, "This game has no spectator market", http.StatusNotFound)
+		return
+	}
+	err = backSide(r.Context(), marketAddr, private, side, *value)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/games/"+contractAddr, http.StatusFound)
+}
+
+//claimMarketHandler pays out a settled market; it's keyed by the market
+//address, since the game contract self-destructs when it settles
+func claimMarketHandler(w http.ResponseWriter, r *http.Request) {
+	marketAddr := r.URL.Path[len("/market/claim/"):]
+	if r.Method == "POST" {
+		f := r.FormValue
+		private := f("private")
+		approve, _ := strconv.ParseBool(f("approve"))
+		if approve != true {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		err := claimMarket(r.Context(), marketAddr, private)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	} else {
+		settled, err := getMarketSettled(r.Context(), marketAddr)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		refundBlock, err := getMarketUint(r.Context(), marketAddr, "refundBlock")
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		var message string
+		if settled {
+			message = "The game is over! Claim your winnings (or your stake, on a draw) by entering your private key."
+		} else {
+			message = "The game isn't settled yet, so there's nothing to claim. Claiming will fail until the game is over, or until block " + strconv.Itoa(refundBlock) + ", when claiming voids the market and refunds everyone's stake."
+		}
+		data := struct {
+			Message string
+			Post    string
+		}{
+			message,
+			"/market/claim/" + marketAddr,
+		}
+		err = templates.ExecuteTemplate(w, "authorize.html", data)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		return
+	}
+}
+
+//getMarketInfo gathers the market state for the game page, nil if the game has none
+func getMarketInfo(ctx context.Context, contractAddr string) (market *MarketInfo, err error) {
+	marketAddr, err := getMarket(ctx, contractAddr)
+	if err != nil || marketAddr == "" {
+		return
+	}
+	m := MarketInfo{ContractAddr: marketAddr}
+	m.Cutoff, err = getMarketUint(ctx, marketAddr, "cutoff")
+	if err != nil {
+		return
+	}
+	m.Settled, err = getMarketSettled(ctx, marketAddr)
+	if err != nil {
+		return
+	}
+	m.RefundBlock, err = getMarketUint(ctx, marketAddr, "refundBlock")
+	if err != nil {
+		return
+	}
+	m.TotalBlack, err = getMarketTotal(ctx, marketAddr, "totalBlack")
+	if err != nil {
+		return
+	}
+	m.TotalWhite, err = getMarketTotal(ctx, marketAddr, "totalWhite")
+	if err != nil {
+		return
+	}
+	numMoves, err := getNumMoves(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	m.Open = !m.Settled && numMoves < m.Cutoff
+	market = &m
+	return
+}
+
+//market contract helpers
+func publishMarket(ctx context.Context, private string, contractAddr string, cutoff int) (marketAddr string, err error) {
+	contract := bcyeth.Contract{
+		Private:  private,
+		Bin:      contracts["SpectatorMarket"].Bin,
+		ABI:      contracts["SpectatorMarket"].ABI,
+		Params:   []interface{}{contractAddr, cutoff, marketTimeout},
+		GasLimit: 600000,
+	}
+	result, err := bcy.CreateContractContext(ctx, contract)
+	if err != nil {
+		return
+	}
+	marketAddr = result[0].Address
+	return
+}
+
+func setMarket(ctx context.Context, contractAddr string, private string, marketAddr string) (err error) {
+	_, err = callEthDuck(ctx, bcyeth.Contract{Private: private, Params: []interface{}{marketAddr}, GasLimit: 100000}, contractAddr, "setMarket")
+	return
+}
+
+func backSide(ctx context.Context, marketAddr string, private string, side string, value big.Int) (err error) {
+	method := "backBlack"
+	if side == "white" {
+		method = "backWhite"
+	}
+	_, err = bcy.CallContractContext(ctx, bcyeth.Contract{Private: private, GasLimit: 100000, Value: value}, marketAddr, method)
+	return
+}
+
+func claimMarket(ctx context.Context, marketAddr string, private string) (err error) {
+	_, err = bcy.CallContractContext(ctx, bcyeth.Contract{Private: private, GasLimit: 100000}, marketAddr, "claim")
+	return
+}
+
+//constant market methods
+func getMarket(ctx context.Context, contractAddr string) (marketAddr string, err error) {
+	result, err := callEthDuck(ctx, bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, contractAddr, "market")
+	//older versions can't have a market
+	if err == errOlderVersion {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	marketAddr = result.Results[0].(string)
+	//an unset address comes back as all zeroes
+	if strings.Trim(marketAddr, "0x") == "" {
+		marketAddr = ""
+	}
+	return
+}
+
+//getMarketUint gets the cutoff move or refund block of a market
+func getMarketUint(ctx context.Context, marketAddr string, method string) (n int, err error) {
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, marketAddr, method)
+	if err != nil {
+		return
+	}
+	num, err := result.Results[0].(json.Number).Int64()
+	if err != nil {
+		return
+	}
+	n = int(num)
+	return
+}
+
+func getMarketSettled(ctx context.Context, marketAddr string) (settled bool, err error) {
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, marketAddr, "settled")
+	if err != nil {
+		return
+	}
+	settled = result.Results[0].(bool)
+	return
+}
+
+func getMarketTotal(ctx context.Context, marketAddr string, method string) (total *big.Int, err error) {
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000"}, marketAddr, method)
+	if err != nil {
+		return
+	}
+	total, err = resultBigInt(result.Results[0])
+	return
+}
@@ -0,0 +1,88 @@
+pragma solidity ^0.4.0;
+
+//the part of EthDuck the market needs to read
+contract EthDuckGame {
+	function getNumMoves() constant returns (uint _moves);
+}
+
+/// @title SpectatorMarket
+/// @author acityinohio
+contract SpectatorMarket {
+	EthDuckGame public game;
+	uint public cutoff;
+	//if the game hasn't settled the market by this block, claiming voids it and refunds everyone,
+	//so stakes aren't locked in a game that's abandoned or self-destructs without settling
+	uint public refundBlock;
+	bool public settled;
+	//1 for black, 2 for white, 3 for a draw, same as EthDuck's State plus draw
+	uint8 public result;
+	uint public totalBlack;
+	uint public totalWhite;
+	mapping (address => uint) public blackStakes;
+	mapping (address => uint) public whiteStakes;
+
+	//constructor for initializing market on an EthDuck game
+	//spectators can back black or white until the game has _cutoff moves
+	//and the game has _timeout blocks to settle it before it can be voided
+	function SpectatorMarket(address _game, uint _cutoff, uint _timeout) {
+		game = EthDuckGame(_game);
+		cutoff = _cutoff;
+		refundBlock = block.number + _timeout;
+	}
+
+	//modifier to restrict bets to before the cutoff move, and before settlement
+	modifier onlyOpen() { if (settled || game.getNumMoves() >= cutoff) { throw; } _; }
+
+	//back black stone to win, with the value sent
+	function backBlack() payable
+	onlyOpen()
+	{
+		blackStakes[msg.sender] += msg.value;
+		totalBlack += msg.value;
+	}
+
+	//back white stone to win, with the value sent
+	function backWhite() payable
+	onlyOpen()
+	{
+		whiteStakes[msg.sender] += msg.value;
+		totalWhite += msg.value;
+	}
+
+	//called by the game itself when it settles or is refunded, right before it self-destructs
+	//the game ignores it if this fails, and a market voided by timeout just keeps its refunds
+	function settle(uint8 _result) {
+		if (msg.sender != address(game)) {
+			throw;
+		}
+		if (!settled) {
+			(settled, result) = (true, _result);
+		}
+	}
+
+	//after settlement, backers of the winner split the whole market in proportion to their stakes
+	//on a draw, or if no one backed the winner, everyone gets their stake back
+	//past refundBlock, the first claim on an unsettled market voids it like a draw
+	function claim() {
+		if (!settled) {
+			if (block.number <= refundBlock) {
+				throw;
+			}
+			(settled, result) = (true, 3);
+		}
+		uint _black = blackStakes[msg.sender];
+		uint _white = whiteStakes[msg.sender];
+		(blackStakes[msg.sender], whiteStakes[msg.sender]) = (0, 0);
+		uint _payout;
+		if (result == 1 && totalBlack > 0) {
+			_payout = _black * (totalBlack + totalWhite) / totalBlack;
+		} else if (result == 2 && totalWhite > 0) {
+			_payout = _white * (totalBlack + totalWhite) / totalWhite;
+		} else {
+			_payout = _black + _white;
+		}
+		if (_payout > 0 && !msg.sender.send(_payout)) {
+			throw;
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//Ethereum JSON-RPC endpoint for fetching contract logs, set with the -rpc flag;
+//game timelines are only available when it's set
+var rpcURL string
+
+//events emitted by ethduck.sol, keep in sync with the contract
+var ethDuckEventDecls = []string{
+	"GameConfirmed(address indexed white, uint wager)",
+	"MoveProposed(address indexed player, uint8 x, uint8 y, uint stake)",
+	"MoveAuthorized(address indexed player, bool approved)",
+	"WinnerProposed(address indexed player)",
+	"WinnerAuthorized(address indexed player, bool approved)",
+	"DrawProposed(address indexed player)",
+	"DrawAuthorized(address indexed player, bool approved)",
+	"NigiriRevealed(address indexed player)",
+	"ColorsDecided(address indexed black, address indexed white)",
+	"GameRefunded(uint refund)",
+	"MarketSet(address indexed player, address market)",
+	"GameSettled(uint8 result, uint payout)",
+	"ChannelOpened(address indexed player)",
+	"ChannelDisputed(address indexed player, uint nonce)",
+}
+
+//ethDuckEvents maps each event's topic to its definition
+var ethDuckEvents = make(map[string]bcyeth.Event)
+
+func init() {
+	for _, decl := range ethDuckEventDecls {
+		event, err := bcyeth.ParseEvent(decl)
+		if err != nil {
+			panic(err)
+		}
+		ethDuckEvents[event.Topic()] = event
+	}
+}
+
+//TimelineEntry is one decoded event of a game
+type TimelineEntry struct {
+	Block  int64
+	TXHash string
+	Event  string
+	Args   string
+}
+
+func timelineHandler(w http.ResponseWriter, r *http.Request) {
+	contractAddr := r.URL.Path[len("/timeline/"):]
+	if rpcURL == "" {
+		http.Error(w, "Timelines need an Ethereum JSON-RPC endpoint, start the server with -rpc", http.StatusNotFound)
+		return
+	}
+	timeline, err := gameTimeline(r.Context(), contractAddr)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	data := struct {
+		ContractAddr string
+		Timeline     []TimelineEntry
+	}{
+		contractAddr,
+		timeline,
+	}
+	err = templates.ExecuteTemplate(w, "timeline.html", data)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+}
+
+//gameTimeline decodes every EthDuck event a game contract logged, in order;
+//logs from anything else (like a spectator market's) are skipped
+func gameTimeline(ctx context.Context, contractAddr string) (timeline []TimelineEntry, err error) {
+	logs, err := bcyeth.GetLogsContext(ctx, bcy.Client, rpcURL, contractAddr)
+	if err != nil {
+		return
+	}
+	for _, l := range logs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		event, ok := ethDuckEvents[strings.ToLower(l.Topics[0])]
+		if !ok {
+			continue
+		}
+		var args map[string]interface{}
+		args, err = event.Decode(l)
+		if err != nil {
+			return
+		}
+		var entry TimelineEntry
+		entry.Block, err = l.Block()
+		if err != nil {
+			return
+		}
+		entry.TXHash, entry.Event = l.TXHash, event.Name
+		var desc []string
+		for _, in := range event.Inputs {
+			desc = append(desc, fmt.Sprintf("%s: %v", in.Name, args[in.Name]))
+		}
+		entry.Args = strings.Join(desc, ", ")
+		timeline = append(timeline, entry)
+	}
+	return
+}
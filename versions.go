@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/acityinohio/ethduck/bcyeth"
+)
+
+//version of ethduck.sol this server publishes, see its version getter
+const ethDuckVersion = 2
+
+//errOlderVersion is returned when calling a method a game's
+//contract doesn't have, because it's from an older ethduck.sol;
+//getters for newer features return their zero value instead
+var errOlderVersion = errors.New("this game's contract is an older EthDuck version without that feature")
+
+//contract versions by game address, and method names by version;
+//a deployed contract's code never changes, so neither ever expires
+var versions struct {
+	sync.Mutex
+	games   map[string]int
+	methods map[int]map[string]bool
+}
+
+func init() {
+	versions.games = make(map[string]int)
+	versions.methods = make(map[int]map[string]bool)
+}
+
+//ethDuckABI is the ABI of an EthDuck version; older ones
+//are kept in legacy/, named like EthDuck.v1.abi
+func ethDuckABI(version int) (abi json.RawMessage, err error) {
+	if version == ethDuckVersion {
+		abi = contracts["EthDuck"].ABI
+		return
+	}
+	abi, err = legacyABIs.ReadFile("legacy/EthDuck.v" + strconv.Itoa(version) + ".abi")
+	if err != nil {
+		err = errors.New("unknown EthDuck version " + strconv.Itoa(version))
+	}
+	return
+}
+
+//ethDuckMethods is the set of methods (and public getters) an EthDuck version has
+func ethDuckMethods(version int) (methods map[string]bool, err error) {
+	versions.Lock()
+	defer versions.Unlock()
+	if methods = versions.methods[version]; methods != nil {
+		return
+	}
+	abi, err := ethDuckABI(version)
+	if err != nil {
+		return
+	}
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err = json.Unmarshal(abi, &entries); err != nil {
+		return
+	}
+	methods = make(map[string]bool)
+	for _, e := range entries {
+		if e.Type == "function" {
+			methods[e.Name] = true
+		}
+	}
+	versions.methods[version] = methods
+	return
+}
+
+//getVersion detects which ethduck.sol a game contract runs; version 1
+//predates the version getter, so if calling it throws, the contract is
+//checked against the version 1 ABI before giving up. Any other error
+//(a rate limit, a timeout, BlockCypher being down) is returned, and
+//nothing is cached, so the next call tries again
+func getVersion(ctx context.Context, contractAddr string) (version int, err error) {
+	contractAddr = strings.ToLower(strings.TrimPrefix(contractAddr, "0x"))
+	versions.Lock()
+	version, ok := versions.games[contractAddr]
+	versions.Unlock()
+	if ok {
+		return
+	}
+	result, err := bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", ABI: contracts["EthDuck"].ABI}, contractAddr, "version")
+	if err != nil && !bcyeth.IsThrow(err) {
+		return
+	}
+	if err == nil && len(result.Results) > 0 {
+		var num int64
+		num, err = result.Results[0].(json.Number).Int64()
+		if err != nil {
+			return
+		}
+		version = int(num)
+	} else {
+		var abi json.RawMessage
+		abi, err = ethDuckABI(1)
+		if err != nil {
+			return
+		}
+		_, err = bcy.CallContractContext(bcyeth.ReadOnly(ctx), bcyeth.Contract{Private: "c025000000000000000000000000000000000000000000000000000000000000", ABI: abi}, contractAddr, "size")
+		if err != nil {
+			return
+		}
+		version = 1
+	}
+	versions.Lock()
+	versions.games[contractAddr] = version
+	versions.Unlock()
+	return
+}
+
+//callEthDuck calls a method of a game contract through the ABI
+//of the EthDuck version it runs, or returns errOlderVersion
+//if that version doesn't have the method
+func callEthDuck(ctx context.Context, contract bcyeth.Contract, contractAddr string, method string) (result bcyeth.Contract, err error) {
+	version, err := getVersion(ctx, contractAddr)
+	if err != nil {
+		return
+	}
+	methods, err := ethDuckMethods(version)
+	if err != nil {
+		return
+	}
+	if !methods[method] {
+		err = errOlderVersion
+		return
+	}
+	contract.ABI, err = ethDuckABI(version)
+	if err != nil {
+		return
+	}
+	//calls to constant methods are made with the dummy key, and are safe to retry
+	if contract.Private == "c025000000000000000000000000000000000000000000000000000000000000" {
+		result, err = bcy.CallContractContext(bcyeth.ReadOnly(ctx), contract, contractAddr, method)
+		return
+	}
+	result, err = bcy.CallContractContext(ctx, contract, contractAddr, method)
+	if err != nil {
+		return
+	}
+	trackTX(contractAddr, method, result.TXHash())
+	return
+}